@@ -3,8 +3,8 @@ module coursera-go
 go 1.21.0
 
 require (
-	github.com/josharian/intern v1.0.0 // indirect
-	github.com/mailru/easyjson v0.7.7 // indirect
-  github.com/go-sql-driver/mysql v1.7.1 // indirect
+	github.com/go-sql-driver/mysql v1.7.1
+	github.com/mailru/easyjson v0.7.7
 )
 
+require github.com/josharian/intern v1.0.0 // indirect
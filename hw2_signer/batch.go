@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// drain keeps reading in after a stage was cancelled, so upstream stages
+// blocked on send can finish
+func drain(in chan interface{}) {
+	go func() {
+		for range in {
+		}
+	}()
+}
+
+// Batch groups items into []interface{} of up to n items. A batch is also
+// emitted when latency passed since its first item, and on close of in.
+// n <= 0 or latency <= 0 disables the corresponding limit
+func Batch(ctx context.Context, n int, latency time.Duration) job {
+	return func(in, out chan interface{}) {
+		batch := []interface{}{}
+		var timeout <-chan time.Time
+
+		flush := func() bool {
+			timeout = nil
+			if len(batch) == 0 {
+				return true
+			}
+
+			select {
+			case out <- batch:
+				batch = []interface{}{}
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+
+				batch = append(batch, v)
+				if len(batch) == 1 && latency > 0 {
+					timeout = SignerClock.After(latency)
+				}
+
+				if n > 0 && len(batch) >= n && !flush() {
+					drain(in)
+					return
+				}
+
+			case <-timeout:
+				if !flush() {
+					drain(in)
+					return
+				}
+
+			case <-ctx.Done():
+				drain(in)
+				return
+			}
+		}
+	}
+}
+
+// Unbatch emits the items of every []interface{} received from in one by one,
+// other values are passed as is
+func Unbatch(ctx context.Context) job {
+	return func(in, out chan interface{}) {
+		send := func(v interface{}) bool {
+			select {
+			case out <- v:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			var v interface{}
+			var ok bool
+
+			select {
+			case v, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				drain(in)
+				return
+			}
+
+			batch, isBatch := v.([]interface{})
+			if !isBatch {
+				batch = []interface{}{v}
+			}
+
+			for _, item := range batch {
+				if !send(item) {
+					drain(in)
+					return
+				}
+			}
+		}
+	}
+}
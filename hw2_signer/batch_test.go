@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBatchSize(t *testing.T) {
+	ctx := context.Background()
+	batches := []string{}
+	items := []string{}
+
+	ExecutePipeline(
+		source(7),
+		Batch(ctx, 3, 0),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				batches = append(batches, fmt.Sprint(v))
+				out <- v
+			}
+		}),
+		Unbatch(ctx),
+		job(func(in, out chan interface{}) {
+			for v := range in {
+				items = append(items, fmt.Sprint(v))
+			}
+		}),
+	)
+
+	if fmt.Sprint(batches) != "[[0 1 2] [3 4 5] [6]]" {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+
+	if fmt.Sprint(items) != "[0 1 2 3 4 5 6]" {
+		t.Fatalf("unexpected items %v", items)
+	}
+}
+
+func TestBatchLatency(t *testing.T) {
+	clk := useFakeClock(t)
+	in, out := start(Batch(context.Background(), 10, time.Second))
+
+	in <- "a"
+	in <- "b"
+	blockUntil(t, clk, 1)
+	clk.Advance(time.Second)
+
+	if got := fmt.Sprint(<-out); got != "[a b]" {
+		t.Fatalf("exp batch [a b], got %s", got)
+	}
+
+	in <- "c"
+	close(in)
+
+	if got := fmt.Sprint(<-out); got != "[c]" {
+		t.Fatalf("exp partial batch [c], got %s", got)
+	}
+
+	if _, ok := <-out; ok {
+		t.Fatalf("exp out closed")
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in, out := start(Batch(ctx, 0, 0))
+
+	in <- "a"
+	cancel()
+
+	if _, ok := <-out; ok {
+		t.Fatalf("exp out closed without partial batch")
+	}
+
+	// upstream is not blocked after cancel
+	in <- "b"
+	close(in)
+}
+
+func TestUnbatchCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	in, out := start(Unbatch(ctx))
+
+	in <- []interface{}{1, 2, 3}
+	if v := <-out; v != 1 {
+		t.Fatalf("exp 1, got %v", v)
+	}
+	cancel()
+
+	for range out {
+	}
+
+	in <- "x"
+	close(in)
+}
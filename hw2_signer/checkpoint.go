@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type record struct {
+	Stage  string `json:"stage"`
+	Item   string `json:"item"`
+	N      int    `json:"n"`
+	Result string `json:"result"`
+}
+
+type ckey struct {
+	stage string
+	item  string
+	n     int
+}
+
+// Checkpoint is an append-only log of items completed by each stage.
+// Items are identified by value and occurrence number, since equal inputs
+// give equal results it does not matter which duplicate got which number
+type Checkpoint struct {
+	mu   sync.Mutex
+	f    *os.File
+	enc  *json.Encoder
+	done map[ckey]string
+	err  error
+}
+
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Checkpoint{f: f, done: map[ckey]string{}}
+
+	// the last record may be torn by a crash and is dropped, a bad record
+	// before it is an error
+	valid := int64(0)
+	rd := bufio.NewReader(f)
+	for {
+		l, err := rd.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			f.Close()
+			return nil, err
+		}
+		if len(l) == 0 {
+			break
+		}
+
+		last := err == io.EOF
+		if _, perr := rd.Peek(1); perr == io.EOF {
+			last = true
+		}
+
+		r := record{}
+		if jerr := json.Unmarshal(l, &r); jerr != nil {
+			if last {
+				break
+			}
+			f.Close()
+			return nil, fmt.Errorf("checkpoint %s: bad record at offset %d: %w", path, valid, jerr)
+		}
+
+		c.done[ckey{r.Stage, r.Item, r.N}] = r.Result
+		valid += int64(len(l))
+
+		// a complete record without its newline
+		if err == io.EOF {
+			if _, err := f.WriteAt([]byte{'\n'}, valid); err != nil {
+				f.Close()
+				return nil, err
+			}
+			valid++
+		}
+	}
+
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(valid, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	c.enc = json.NewEncoder(f)
+
+	return c, nil
+}
+
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.done)
+}
+
+func (c *Checkpoint) lookup(k ckey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rv, ok := c.done[k]
+	return rv, ok
+}
+
+func (c *Checkpoint) record(k ckey, result string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.done[k] = result
+
+	c.err = c.enc.Encode(record{k.stage, k.item, k.n, result})
+	if c.err == nil {
+		c.err = c.f.Sync()
+	}
+}
+
+// Close returns the first write error, if any
+func (c *Checkpoint) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return errors.Join(c.err, c.f.Close())
+}
+
+func (s *stage) key(item string) ckey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen == nil {
+		s.seen = map[string]int{}
+	}
+
+	n := s.seen[item]
+	s.seen[item]++
+
+	return ckey{s.name, item, n}
+}
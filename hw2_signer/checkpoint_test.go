@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	useFakeClock(t)
+
+	var md5Calls, crcCalls int32
+	broken := "5"
+	DataSignerMd5 = func(data string) string {
+		atomic.AddInt32(&md5Calls, 1)
+		return "md5" + data
+	}
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddInt32(&crcCalls, 1)
+		if data == broken {
+			panic("crash")
+		}
+		return crc(data)
+	}
+
+	pipeline := func(p *Pipeline) string {
+		rv := []string{}
+		p.Execute(source(7), SingleHash, MultiHash, CombineResults, collect(&rv))
+		return rv[0]
+	}
+
+	path := filepath.Join(t.TempDir(), "signer.log")
+	cp, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partial := pipeline(&Pipeline{Checkpoint: cp})
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 6 items passed both hash stages
+	if cp.Len() != 12 {
+		t.Fatalf("exp 12 records, got %d", cp.Len())
+	}
+
+	broken = ""
+	expected := pipeline(&Pipeline{})
+	if partial == expected {
+		t.Fatalf("first run should have lost an item")
+	}
+
+	// torn record left by a crash in the middle of a write
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"stage":"SingleHash","it`)
+	f.Close()
+
+	cp, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+
+	atomic.StoreInt32(&md5Calls, 0)
+	atomic.StoreInt32(&crcCalls, 0)
+
+	resumed := pipeline(&Pipeline{Checkpoint: cp})
+	if resumed != expected {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", resumed, expected)
+	}
+
+	// only the lost item is hashed again: 2 crc32 in SingleHash and 6 in MultiHash
+	if md5Calls != 1 || crcCalls != 8 {
+		t.Fatalf("exp 1 md5 and 8 crc32 calls, got %d and %d", md5Calls, crcCalls)
+	}
+
+	if cp.Len() != 14 {
+		t.Fatalf("exp 14 records, got %d", cp.Len())
+	}
+}
+
+func TestCheckpointRecords(t *testing.T) {
+	rec := func(item, result string) string {
+		return `{"stage":"A","item":"` + item + `","n":0,"result":"` + result + `"}`
+	}
+	big := strings.Repeat("x", 2<<20)
+
+	tests := []struct {
+		name string
+		data string
+		len  int
+		size int
+		err  bool
+	}{
+		{"record over 1MB", rec("1", "") + "\n" + rec("2", big) + "\n" + rec("3", "") + "\n", 3, -1, false},
+		{"torn last record", rec("1", "") + "\n" + rec("2", "")[:10], 1, len(rec("1", "")) + 1, false},
+		{"last record without newline", rec("1", "") + "\n" + rec("2", ""), 2, 2 * (len(rec("1", "")) + 1), false},
+		{"bad record before the last", rec("1", "") + "\n{bad\n" + rec("3", "") + "\n", 0, -1, true},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "signer.log")
+		if err := os.WriteFile(path, []byte(test.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cp, err := OpenCheckpoint(path)
+		if (err != nil) != test.err {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if err == nil {
+			if cp.Len() != test.len {
+				t.Errorf("%s: exp %d records, got %d", test.name, test.len, cp.Len())
+			}
+			cp.Close()
+		}
+
+		size := test.size
+		if size < 0 {
+			size = len(test.data)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != int64(size) {
+			t.Errorf("%s: exp file of %d bytes, got %d", test.name, size, fi.Size())
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the part of time.Timer the pipeline uses, C is a method here
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// SignerClock is used by the signer functions and pipeline timers instead of
+// the time package, so tests can replace it with a FakeClock
+var SignerClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// FakeClock only moves when Advance is called. Sleepers and timers are woken
+// in deadline order, so the virtual time spent by a pipeline does not depend
+// on the scheduler
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+	changed chan struct{}
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.add(d, ch)
+
+	return ch
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{c: c, ch: make(chan time.Time, 1)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(d, t.ch)
+
+	return t
+}
+
+// add fires ch after d, c.mu must be held
+func (c *FakeClock) add(d time.Duration, ch chan time.Time) {
+	if d <= 0 {
+		fire(ch, c.now)
+		return
+	}
+
+	c.waiters = append(c.waiters, waiter{c.now.Add(d), ch})
+	c.notify()
+}
+
+// remove drops the waiter of ch and reports whether there was one, c.mu
+// must be held
+func (c *FakeClock) remove(ch chan time.Time) bool {
+	for i, w := range c.waiters {
+		if w.ch == ch {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.notify()
+			return true
+		}
+	}
+
+	return false
+}
+
+type fakeTimer struct {
+	c  *FakeClock
+	ch chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+
+	active := t.c.remove(t.ch)
+	t.c.add(d, t.ch)
+
+	return active
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+
+	return t.c.remove(t.ch)
+}
+
+// Advance moves the clock forward and fires every waiter whose deadline has passed
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].at.Before(c.waiters[j].at)
+	})
+
+	n := 0
+	for n < len(c.waiters) && !c.waiters[n].at.After(c.now) {
+		fire(c.waiters[n].ch, c.waiters[n].at)
+		n++
+	}
+	c.waiters = c.waiters[n:]
+	c.notify()
+}
+
+// AdvanceNext moves the clock to the nearest deadline and returns the step taken
+func (c *FakeClock) AdvanceNext() time.Duration {
+	c.mu.Lock()
+	if len(c.waiters) == 0 {
+		c.mu.Unlock()
+		return 0
+	}
+
+	next := c.waiters[0].at
+	for _, w := range c.waiters {
+		if w.at.Before(next) {
+			next = w.at
+		}
+	}
+	d := next.Sub(c.now)
+	c.mu.Unlock()
+
+	c.Advance(d)
+	return d
+}
+
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n goroutines are sleeping on the clock
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		if len(c.waiters) >= n {
+			c.mu.Unlock()
+			return
+		}
+		ch := c.changed
+		c.mu.Unlock()
+
+		<-ch
+	}
+}
+
+// fire does not block when ch still has a value nobody received, as with
+// time.Timer the value is then dropped
+func fire(ch chan time.Time, t time.Time) {
+	select {
+	case ch <- t:
+	default:
+	}
+}
+
+func (c *FakeClock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
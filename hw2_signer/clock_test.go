@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSigner replaces the signer functions, keep the originals
+var (
+	signerMd5      = DataSignerMd5
+	signerCrc32    = DataSignerCrc32
+	overheatLock   = OverheatLock
+	overheatUnlock = OverheatUnlock
+)
+
+func useFakeClock(t *testing.T) *FakeClock {
+	clk := NewFakeClock(time.Unix(0, 0))
+
+	prev, prevMd5, prevCrc32, prevLock, prevUnlock := SignerClock, DataSignerMd5, DataSignerCrc32, OverheatLock, OverheatUnlock
+	SignerClock = clk
+	DataSignerMd5, DataSignerCrc32 = signerMd5, signerCrc32
+	OverheatLock, OverheatUnlock = overheatLock, overheatUnlock
+
+	t.Cleanup(func() {
+		SignerClock = prev
+		DataSignerMd5, DataSignerCrc32 = prevMd5, prevCrc32
+		OverheatLock, OverheatUnlock = prevLock, prevUnlock
+	})
+
+	return clk
+}
+
+func blockUntil(t *testing.T, clk *FakeClock, n int) {
+	done := make(chan struct{})
+	go func() {
+		clk.BlockUntil(n)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected %d sleepers, got %d", n, clk.Waiters())
+	}
+}
+
+func source(n int) job {
+	return func(in, out chan interface{}) {
+		for i := 0; i < n; i++ {
+			out <- i
+		}
+	}
+}
+
+func collect(rv *[]string) job {
+	return func(in, out chan interface{}) {
+		for v := range in {
+			*rv = append(*rv, v.(string))
+		}
+		sort.Strings(*rv)
+	}
+}
+
+func crc(data string) string {
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data))), 10)
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	clk := NewFakeClock(start)
+
+	select {
+	case <-clk.After(0):
+	default:
+		t.Fatalf("After(0) should fire immediately")
+	}
+
+	late := clk.After(2 * time.Second)
+	early := clk.After(time.Second)
+
+	clk.Advance(500 * time.Millisecond)
+	if clk.Waiters() != 2 {
+		t.Fatalf("exp 2 waiters, got %d", clk.Waiters())
+	}
+
+	if d := clk.AdvanceNext(); d != 500*time.Millisecond {
+		t.Fatalf("exp step 500ms, got %s", d)
+	}
+	if at := <-early; !at.Equal(start.Add(time.Second)) {
+		t.Fatalf("exp fire at 1s, got %s", at.Sub(start))
+	}
+
+	clk.Advance(time.Hour)
+	if at := <-late; !at.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("exp fire at 2s, got %s", at.Sub(start))
+	}
+
+	if got := clk.Now().Sub(start); got != time.Hour+time.Second {
+		t.Fatalf("exp now 1h1s, got %s", got)
+	}
+}
+
+func TestFakeTimerNotDrained(t *testing.T) {
+	start := time.Unix(0, 0)
+	clk := NewFakeClock(start)
+
+	// the value of the first fire is never received
+	timer := clk.NewTimer(time.Second)
+	clk.Advance(time.Second)
+	timer.Reset(time.Second)
+
+	done := make(chan struct{})
+	go func() {
+		clk.Advance(time.Second)
+		timer.Reset(0)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("clock blocked on a timer that was not drained")
+	}
+
+	if at := <-timer.C(); !at.Equal(start.Add(time.Second)) {
+		t.Fatalf("exp the first fire at 1s, got %s", at.Sub(start))
+	}
+}
+
+func TestMultiHashVirtual(t *testing.T) {
+	clk := useFakeClock(t)
+	n := 10
+	start := clk.Now()
+	rv := []string{}
+
+	done := make(chan struct{})
+	go func() {
+		ExecutePipeline(source(n), MultiHash, collect(&rv))
+		close(done)
+	}()
+
+	// all 6 crc32 calls for all n values must sleep at the same time
+	blockUntil(t, clk, 6*n)
+	clk.Advance(time.Second)
+	<-done
+
+	if len(rv) != n {
+		t.Fatalf("exp %d results, got %d", n, len(rv))
+	}
+
+	if got := clk.Now().Sub(start); got != time.Second {
+		t.Fatalf("MultiHash took %s virtual time, expected 1s", got)
+	}
+}
+
+func TestSingleHashVirtual(t *testing.T) {
+	clk := useFakeClock(t)
+	n := 7
+	start := clk.Now()
+	rv := []string{}
+
+	done := make(chan struct{})
+	go func() {
+		ExecutePipeline(source(n), SingleHash, collect(&rv))
+		close(done)
+	}()
+
+	// crc32(data) calls sleep in parallel, md5 calls go one by one
+	for k := 0; k < n; k++ {
+		blockUntil(t, clk, n+k+1)
+		clk.Advance(10 * time.Millisecond)
+	}
+	blockUntil(t, clk, 2*n)
+	clk.Advance(time.Second)
+	<-done
+
+	exp := []string{}
+	for i := 0; i < n; i++ {
+		data := fmt.Sprint(i)
+		exp = append(exp, crc(data)+"~"+crc(fmt.Sprintf("%x", md5.Sum([]byte(data)))))
+	}
+	sort.Strings(exp)
+
+	if fmt.Sprint(rv) != fmt.Sprint(exp) {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", rv, exp)
+	}
+
+	exptime := time.Second + time.Duration(n)*10*time.Millisecond
+	if got := clk.Now().Sub(start); got != exptime {
+		t.Fatalf("SingleHash took %s virtual time, expected %s", got, exptime)
+	}
+}
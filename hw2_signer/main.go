@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	opts := options{}
+
+	flag.StringVar(&opts.chain, "chain", "single,multi,combine", "comma separated stages: single, multi, combine, count=N, every=DURATION, session=DURATION")
+	flag.StringVar(&opts.format, "format", "lines", "output format: lines or json")
+	flag.StringVar(&opts.salt, "salt", "", "salt appended to the data before hashing")
+	flag.IntVar(&opts.concurrency, "concurrency", 0, "max items hashed at once by each stage, 0 is unlimited")
+	flag.BoolVar(&opts.ordered, "ordered", false, "keep input order in hash stages output")
+	flag.BoolVar(&opts.quiet, "quiet", false, "do not print progress and summary")
+	flag.StringVar(&opts.trace, "trace", "", "write a chrome trace event file of the run")
+	flag.DurationVar(&opts.watchdog, "watchdog", 0, "cancel the run when nothing moved for this long, 0 disables")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	inputs := []io.Reader{os.Stdin}
+	if flag.NArg() > 0 {
+		inputs = inputs[:0]
+		for _, name := range flag.Args() {
+			f, err := os.Open(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+
+			inputs = append(inputs, f)
+		}
+	}
+
+	status := io.Writer(os.Stderr)
+	if opts.quiet {
+		status = io.Discard
+	}
+
+	summary, err := runCommand(opts, inputs, os.Stdout, status)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if summary.Err() != nil {
+		os.Exit(1)
+	}
+}
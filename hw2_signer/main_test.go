@@ -50,6 +50,9 @@ func TestSigner(t *testing.T) {
 	testExpected := "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
 	testResult := "NOT_SET"
 
+	// the signer functions sleep on the fake clock, the test moves it
+	clk := useFakeClock(t)
+
 	// это небольшая защита от попыток не вызывать мои функции расчета
 	// я преопределяю фукции на свои которые инкрементят локальный счетчик
 	// переопределение возможо потому что я объявил функцию как переменную, в которой лежит функция
@@ -65,7 +68,7 @@ func TestSigner(t *testing.T) {
 		for {
 			if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 0, 1); !swapped {
 				fmt.Println("OverheatLock happend")
-				time.Sleep(time.Second)
+				SignerClock.Sleep(time.Second)
 			} else {
 				break
 			}
@@ -76,7 +79,7 @@ func TestSigner(t *testing.T) {
 		for {
 			if swapped := atomic.CompareAndSwapUint32(&dataSignerOverheat, 1, 0); !swapped {
 				fmt.Println("OverheatUnlock happend")
-				time.Sleep(time.Second)
+				SignerClock.Sleep(time.Second)
 			} else {
 				break
 			}
@@ -88,7 +91,7 @@ func TestSigner(t *testing.T) {
 		defer OverheatUnlock()
 		data += DataSignerSalt
 		dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
-		time.Sleep(10 * time.Millisecond)
+		SignerClock.Sleep(10 * time.Millisecond)
 		return dataHash
 	}
 	DataSignerCrc32 = func(data string) string {
@@ -96,7 +99,7 @@ func TestSigner(t *testing.T) {
 		data += DataSignerSalt
 		crcH := crc32.ChecksumIEEE([]byte(data))
 		dataHash := strconv.FormatUint(uint64(crcH), 10)
-		time.Sleep(time.Second)
+		SignerClock.Sleep(time.Second)
 		return dataHash
 	}
 
@@ -122,11 +125,28 @@ func TestSigner(t *testing.T) {
 		}),
 	}
 
-	start := time.Now()
+	start := clk.Now()
+
+	done := make(chan struct{})
+	go func() {
+		ExecutePipeline(hashSignJobs...)
+		close(done)
+	}()
 
-	ExecutePipeline(hashSignJobs...)
+	// md5 calls go one by one while crc32 of the data sleeps, all the
+	// MultiHash calls start after SingleHash and sleep at the same time
+	n := len(inputData)
+	for k := 0; k < n; k++ {
+		blockUntil(t, clk, n+k+1)
+		clk.Advance(10 * time.Millisecond)
+	}
+	blockUntil(t, clk, 2*n)
+	clk.Advance(time.Second)
+	blockUntil(t, clk, 6*n)
+	clk.Advance(time.Second)
+	<-done
 
-	end := time.Since(start)
+	end := clk.Now().Sub(start)
 
 	expectedTime := 3 * time.Second
 
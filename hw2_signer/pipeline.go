@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pipeline holds the run options that ExecutePipeline uses with defaults.
+// Policies are looked up by stage name: the job function name
+// (SingleHash, MultiHash...) or stageN for anonymous jobs
+type Pipeline struct {
+	Policies map[string]Policy
+	// DeadLetter gets the failures while the pipeline runs. Sending does not
+	// block, failures the channel has no room for are counted in
+	// Summary.Dropped, all of them are in Summary.Failures
+	DeadLetter chan<- Failure
+	Checkpoint *Checkpoint
+	// Watchdog cancels the run when no item moved for this long
+	Watchdog time.Duration
+}
+
+type run struct {
+	p        *Pipeline
+	stages   map[chan interface{}]*stage
+	mu       sync.Mutex
+	failures []Failure
+	dropped  int
+	progress int64
+}
+
+type stage struct {
+	name   string
+	policy Policy
+	run    *run
+
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+// running holds the runs in progress. Jobs keep the plain func(in, out)
+// signature, so a stage is found by the input channel of its job in the
+// stages of these runs
+var running = struct {
+	sync.Mutex
+	runs map[*run]bool
+}{runs: map[*run]bool{}}
+
+func stageFor(in chan interface{}) *stage {
+	running.Lock()
+	defer running.Unlock()
+
+	for r := range running.runs {
+		if s, ok := r.stages[in]; ok {
+			return s
+		}
+	}
+
+	return &stage{run: &run{p: &Pipeline{}}}
+}
+
+func stageName(i int, j job) string {
+	name := runtime.FuncForPC(reflect.ValueOf(j).Pointer()).Name()
+	name = name[strings.LastIndexByte(name, '.')+1:]
+
+	if name == "" || strings.HasPrefix(name, "func") || strings.Trim(name, "0123456789") == "" {
+		return fmt.Sprintf("stage%d", i)
+	}
+
+	return name
+}
+
+func (p *Pipeline) Execute(jobs ...job) Summary {
+	r := &run{p: p, stages: map[chan interface{}]*stage{}}
+
+	chs := make([]chan interface{}, len(jobs)+1)
+	for i := 0; i < len(jobs)+1; i++ {
+		chs[i] = make(chan interface{})
+	}
+
+	names := make([]string, len(jobs))
+	for i, j := range jobs {
+		names[i] = stageName(i, j)
+		r.stages[chs[i]] = &stage{name: names[i], policy: p.Policies[names[i]], run: r}
+	}
+
+	running.Lock()
+	running.runs[r] = true
+	running.Unlock()
+
+	outs := chs[1:]
+	var w *watchdog
+	if p.Watchdog > 0 && len(jobs) > 0 {
+		w = newWatchdog(r, p.Watchdog, jobs, names, chs)
+		outs = w.outs
+	}
+
+	wg := sync.WaitGroup{}
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int, j job, in, out chan interface{}) {
+			defer wg.Done()
+			j(in, out)
+			close(out)
+			if w != nil {
+				w.finish(i)
+			}
+		}(i, jobs[i], chs[i], outs[i])
+	}
+
+	summary := Summary{}
+	if w != nil {
+		summary.Stalled = w.wait(&wg)
+	} else {
+		wg.Wait()
+	}
+
+	running.Lock()
+	delete(running.runs, r)
+	running.Unlock()
+
+	r.mu.Lock()
+	summary.Failures = r.failures
+	summary.Dropped = r.dropped
+	r.mu.Unlock()
+
+	return summary
+}
+
+func (r *run) tick() {
+	atomic.AddInt64(&r.progress, 1)
+}
+
+func (r *run) fail(f Failure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures = append(r.failures, f)
+
+	if r.p.DeadLetter != nil {
+		select {
+		case r.p.DeadLetter <- f:
+		default:
+			r.dropped++
+		}
+	}
+}
+
+// sequencer forwards results to out in the order their slots were taken
+type sequencer struct {
+	queue chan chan interface{}
+	done  chan struct{}
+}
+
+func newSequencer(out chan interface{}) *sequencer {
+	s := &sequencer{
+		queue: make(chan chan interface{}, MaxInputDataLen),
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		for slot := range s.queue {
+			if v, ok := <-slot; ok {
+				out <- v
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *sequencer) slot() chan interface{} {
+	ch := make(chan interface{}, 1)
+	s.queue <- ch
+	return ch
+}
+
+func (s *sequencer) close() {
+	close(s.queue)
+	<-s.done
+}
+
+func (s *stage) process(in, out chan interface{}, cb func(string) (string, error)) {
+	wg := sync.WaitGroup{}
+
+	var sem chan struct{}
+	if s.policy.Concurrency > 0 {
+		sem = make(chan struct{}, s.policy.Concurrency)
+	}
+
+	var seq *sequencer
+	if s.policy.Ordered {
+		seq = newSequencer(out)
+	}
+
+	for i := range in {
+		if sem != nil {
+			sem <- struct{}{}
+		}
+
+		var slot chan interface{}
+		if seq != nil {
+			slot = seq.slot()
+		}
+
+		wg.Add(1)
+		go func(item interface{}, slot chan interface{}) {
+			// timed out attempts keep the slot and the stage until they return
+			calls := sync.WaitGroup{}
+			defer func() {
+				calls.Wait()
+				if sem != nil {
+					<-sem
+				}
+				wg.Done()
+			}()
+
+			// envelopes are formatted as their value
+			start := SignerClock.Now()
+			h, ok := s.do(fmt.Sprintf("%v", item), cb, &calls)
+
+			var rv interface{} = h
+			if env, traced := item.(*Envelope); traced && ok {
+				rv = env.next(s.name, start, h)
+			}
+
+			switch {
+			case slot != nil:
+				if ok {
+					slot <- rv
+				}
+				close(slot)
+			case ok:
+				out <- rv
+			}
+		}(i, slot)
+	}
+
+	wg.Wait()
+
+	if seq != nil {
+		seq.close()
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrTimeout = errors.New("item timeout")
+
+// Policy describes how a stage handles items whose callback panics or fails,
+// how many items it processes at once and whether results keep input order.
+// Zero value means a single attempt without timeout, unlimited and unordered
+type Policy struct {
+	Retries     int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	Concurrency int
+	Ordered     bool
+}
+
+type Failure struct {
+	Stage    string
+	Item     interface{}
+	Attempts int
+	Err      error
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("%s: item %v failed after %d attempts: %s", f.Stage, f.Item, f.Attempts, f.Err)
+}
+
+func (f Failure) Unwrap() error {
+	return f.Err
+}
+
+type Summary struct {
+	Failures []Failure
+	// Dropped is the number of failures DeadLetter had no room for
+	Dropped int
+	Stalled *StallError
+}
+
+func (s Summary) ByStage() map[string]int {
+	rv := map[string]int{}
+	for _, f := range s.Failures {
+		rv[f.Stage]++
+	}
+
+	return rv
+}
+
+func (s Summary) Err() error {
+	errs := make([]error, len(s.Failures))
+	for i, f := range s.Failures {
+		errs[i] = f
+	}
+
+	if s.Stalled != nil {
+		errs = append(errs, s.Stalled)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p Policy) backoff(attempt int) time.Duration {
+	d := p.Backoff << (attempt - 1)
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
+
+// protect turns a panic of f into an error
+func protect(f func() (string, error)) (rv string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return f()
+}
+
+// try makes one attempt. The signer functions can't be interrupted, so an
+// attempt that timed out is not cancelled: it keeps running until it returns
+// and is counted in calls, which the stage waits for
+func (s *stage) try(item string, cb func(string) (string, error), calls *sync.WaitGroup) (string, error) {
+	call := func() (string, error) {
+		return protect(func() (string, error) { return cb(item) })
+	}
+
+	if s.policy.Timeout <= 0 {
+		return call()
+	}
+
+	type result struct {
+		rv  string
+		err error
+	}
+
+	ch := make(chan result, 1)
+	calls.Add(1)
+	go func() {
+		defer calls.Done()
+		rv, err := call()
+		ch <- result{rv, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.rv, r.err
+	case <-SignerClock.After(s.policy.Timeout):
+		return "", ErrTimeout
+	}
+}
+
+func (s *stage) do(item string, cb func(string) (string, error), calls *sync.WaitGroup) (string, bool) {
+	cp := s.run.p.Checkpoint
+	k := ckey{}
+	if cp != nil {
+		k = s.key(item)
+		if rv, ok := cp.lookup(k); ok {
+			return rv, true
+		}
+	}
+
+	var err error
+
+	for attempt := 0; attempt <= s.policy.Retries; attempt++ {
+		if attempt > 0 {
+			SignerClock.Sleep(s.policy.backoff(attempt))
+		}
+
+		var rv string
+		rv, err = s.try(item, cb, calls)
+		if err == nil {
+			if cp != nil {
+				cp.record(k, rv)
+			}
+			s.run.tick()
+			return rv, true
+		}
+	}
+
+	s.run.tick()
+	s.run.fail(Failure{s.name, item, s.policy.Retries + 1, err})
+
+	return "", false
+}
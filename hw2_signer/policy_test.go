@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPanicToDeadLetter(t *testing.T) {
+	useFakeClock(t)
+	DataSignerMd5 = func(data string) string { return "md5" + data }
+	DataSignerCrc32 = func(data string) string {
+		if data == "3" {
+			panic("overheat")
+		}
+		return "crc" + data
+	}
+
+	dead := make(chan Failure, 10)
+	rv := []string{}
+	p := &Pipeline{DeadLetter: dead}
+
+	summary := p.Execute(source(5), SingleHash, collect(&rv))
+
+	if len(rv) != 4 {
+		t.Fatalf("exp 4 results, got %v", rv)
+	}
+
+	if len(summary.Failures) != 1 || len(dead) != 1 {
+		t.Fatalf("exp 1 failure, got %v", summary.Failures)
+	}
+
+	f := <-dead
+	if f.Stage != "SingleHash" || f.Item != "3" || f.Attempts != 1 {
+		t.Fatalf("unexpected failure %#v", f)
+	}
+
+	if !strings.Contains(f.Err.Error(), "overheat") {
+		t.Fatalf("exp panic value in error, got %s", f.Err)
+	}
+
+	if summary.ByStage()["SingleHash"] != 1 || summary.Err() == nil {
+		t.Fatalf("summary does not report failure: %v", summary.ByStage())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	clk := useFakeClock(t)
+	start := clk.Now()
+
+	var calls int32
+	flaky := job(func(in, out chan interface{}) {
+		hash(in, out, func(data string) (string, error) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return "", fmt.Errorf("flaky")
+			}
+			return data, nil
+		})
+	})
+
+	rv := []string{}
+	p := &Pipeline{Policies: map[string]Policy{
+		"stage1": {Retries: 3, Backoff: 100 * time.Millisecond},
+	}}
+
+	done := make(chan Summary)
+	go func() {
+		done <- p.Execute(source(1), flaky, collect(&rv))
+	}()
+
+	blockUntil(t, clk, 1)
+	clk.Advance(100 * time.Millisecond)
+	blockUntil(t, clk, 1)
+	clk.Advance(200 * time.Millisecond)
+	summary := <-done
+
+	if len(summary.Failures) != 0 || len(rv) != 1 {
+		t.Fatalf("exp success after retries, got %v %v", rv, summary.Failures)
+	}
+
+	if got := clk.Now().Sub(start); got != 300*time.Millisecond {
+		t.Fatalf("exp 300ms of backoff, got %s", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		exp     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := p.backoff(test.attempt); got != test.exp {
+			t.Errorf("attempt %d: exp %s, got %s", test.attempt, test.exp, got)
+		}
+	}
+}
+
+func TestItemTimeout(t *testing.T) {
+	clk := useFakeClock(t)
+	stuck := make(chan struct{})
+
+	DataSignerCrc32 = func(data string) string {
+		<-stuck
+		return data
+	}
+
+	dead := make(chan Failure, 1)
+	p := &Pipeline{
+		Policies: map[string]Policy{
+			"MultiHash": {Retries: 1, Backoff: 10 * time.Millisecond, Timeout: time.Second},
+		},
+		DeadLetter: dead,
+	}
+
+	done := make(chan Summary)
+	go func() {
+		done <- p.Execute(source(1), MultiHash, collect(&[]string{}))
+	}()
+
+	blockUntil(t, clk, 1)
+	clk.Advance(time.Second)
+	blockUntil(t, clk, 1)
+	clk.Advance(10 * time.Millisecond)
+	blockUntil(t, clk, 1)
+	clk.Advance(time.Second)
+
+	f := <-dead
+	if !errors.Is(f, ErrTimeout) || f.Attempts != 2 || f.Stage != "MultiHash" {
+		t.Fatalf("unexpected failure %#v", f)
+	}
+
+	// both timed out attempts are still running
+	select {
+	case <-done:
+		t.Fatal("pipeline returned before its attempts")
+	default:
+	}
+
+	close(stuck)
+	summary := <-done
+
+	if len(summary.Failures) != 1 {
+		t.Fatalf("exp 1 failure, got %v", summary.Failures)
+	}
+}
+
+func TestItemTimeoutConcurrency(t *testing.T) {
+	clk := useFakeClock(t)
+	stuck := make(chan struct{})
+
+	var calls, running int32
+	slow := job(func(in, out chan interface{}) {
+		hash(in, out, func(data string) (string, error) {
+			atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&calls, 1)
+
+			<-stuck
+			return data, nil
+		})
+	})
+
+	p := &Pipeline{Policies: map[string]Policy{
+		"stage1": {Retries: 2, Timeout: time.Second, Concurrency: 1},
+	}}
+
+	done := make(chan Summary)
+	go func() {
+		done <- p.Execute(source(3), slow, collect(&[]string{}))
+	}()
+
+	// the timed out attempts of the first item keep its slot, the other items wait
+	for i := 0; i < 3; i++ {
+		blockUntil(t, clk, 1)
+		clk.Advance(time.Second)
+	}
+	for atomic.LoadInt32(&calls) != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&running); got != 3 {
+		t.Fatalf("exp 3 running attempts, got %d", got)
+	}
+
+	close(stuck)
+	summary := <-done
+
+	if len(summary.Failures) != 1 || atomic.LoadInt32(&calls) != 3+2 {
+		t.Fatalf("exp the first item to fail and 5 calls, got %v and %d", summary.Failures, calls)
+	}
+}
+
+func TestDeadLetterNoRoom(t *testing.T) {
+	useFakeClock(t)
+	DataSignerMd5 = func(data string) string { return "md5" + data }
+	DataSignerCrc32 = func(data string) string {
+		if data == "1" || data == "3" {
+			panic("overheat")
+		}
+		return "crc" + data
+	}
+
+	// nobody reads it while the pipeline runs
+	dead := make(chan Failure)
+	p := &Pipeline{DeadLetter: dead}
+
+	done := make(chan Summary)
+	go func() {
+		done <- p.Execute(source(5), SingleHash, collect(&[]string{}))
+	}()
+
+	select {
+	case summary := <-done:
+		if len(summary.Failures) != 2 || summary.Dropped != 2 {
+			t.Fatalf("exp 2 failures dropped, got %v, %d dropped", summary.Failures, summary.Dropped)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pipeline blocked on the dead letter channel")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type options struct {
+	chain       string
+	format      string
+	salt        string
+	concurrency int
+	ordered     bool
+	quiet       bool
+	watchdog    time.Duration
+	trace       string
+}
+
+// buildChain turns "single,multi,combine" into jobs, windowed combiners take
+// an argument: count=N, every=DURATION, session=DURATION
+func buildChain(chain string) ([]job, error) {
+	jobs := []job{}
+
+	for _, name := range strings.Split(chain, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(name), "=")
+
+		switch name {
+		case "single":
+			jobs = append(jobs, SingleHash)
+		case "multi":
+			jobs = append(jobs, MultiHash)
+		case "combine":
+			jobs = append(jobs, CombineResults)
+		case "count":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("bad window size %q", arg)
+			}
+			jobs = append(jobs, CombineCount(n))
+		case "every", "session":
+			d, err := time.ParseDuration(arg)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("bad window duration %q", arg)
+			}
+			if name == "every" {
+				jobs = append(jobs, CombineEvery(d))
+			} else {
+				jobs = append(jobs, CombineSession(d))
+			}
+		default:
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+	}
+
+	return jobs, nil
+}
+
+func isHash(j job) bool {
+	name := stageName(0, j)
+	return name == "SingleHash" || name == "MultiHash"
+}
+
+type progress struct {
+	read    int64
+	done    int64
+	written int64
+}
+
+func (p *progress) print(w io.Writer, elapsed time.Duration) {
+	const width = 30
+
+	read, done := atomic.LoadInt64(&p.read), atomic.LoadInt64(&p.done)
+
+	bar := 0
+	if read > 0 {
+		bar = int(done * width / read)
+	}
+
+	fmt.Fprintf(w, "\r[%s%s] %d/%d %s", strings.Repeat("=", bar), strings.Repeat(" ", width-bar), done, read, elapsed.Truncate(time.Millisecond))
+}
+
+func runCommand(opts options, inputs []io.Reader, w, status io.Writer) (Summary, error) {
+	chain, err := buildChain(opts.chain)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	if opts.format != "lines" && opts.format != "json" {
+		return Summary{}, fmt.Errorf("unknown format %q", opts.format)
+	}
+
+	DataSignerSalt = opts.salt
+
+	p := &progress{}
+	var readErr, writeErr error
+
+	source := job(func(in, out chan interface{}) {
+		for _, r := range inputs {
+			sc := bufio.NewScanner(r)
+			for sc.Scan() {
+				out <- sc.Text()
+				atomic.AddInt64(&p.read, 1)
+			}
+
+			if err := sc.Err(); err != nil {
+				readErr = err
+				return
+			}
+		}
+	})
+
+	counter := job(func(in, out chan interface{}) {
+		for v := range in {
+			atomic.AddInt64(&p.done, 1)
+			out <- v
+		}
+	})
+
+	enc := json.NewEncoder(w)
+	sink := job(func(in, out chan interface{}) {
+		for v := range in {
+			if writeErr != nil {
+				continue
+			}
+
+			if opts.format == "json" {
+				writeErr = enc.Encode(struct {
+					Result string `json:"result"`
+				}{fmt.Sprint(v)})
+			} else {
+				_, writeErr = fmt.Fprintln(w, v)
+			}
+			atomic.AddInt64(&p.written, 1)
+		}
+	})
+
+	// progress counts items that passed the last hash stage
+	last := 0
+	for i, j := range chain {
+		if isHash(j) {
+			last = i + 1
+		}
+	}
+
+	jobs := []job{source}
+
+	var tracer *Tracer
+	if opts.trace != "" {
+		tracer = NewTracer()
+		jobs = append(jobs, tracer.Trace())
+	}
+
+	jobs = append(jobs, chain[:last]...)
+	jobs = append(jobs, counter)
+	jobs = append(jobs, chain[last:]...)
+	jobs = append(jobs, sink)
+
+	policy := Policy{Concurrency: opts.concurrency, Ordered: opts.ordered}
+	pipeline := &Pipeline{
+		Policies: map[string]Policy{
+			"SingleHash": policy,
+			"MultiHash":  policy,
+		},
+		Watchdog: opts.watchdog,
+	}
+
+	start := SignerClock.Now()
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		if opts.quiet {
+			<-stop
+			return
+		}
+
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.print(status, SignerClock.Now().Sub(start))
+			case <-stop:
+				p.print(status, SignerClock.Now().Sub(start))
+				fmt.Fprintln(status)
+				return
+			}
+		}
+	}()
+
+	summary := pipeline.Execute(jobs...)
+	close(stop)
+	<-stopped
+
+	for _, f := range summary.Failures {
+		fmt.Fprintln(status, f)
+	}
+	if summary.Stalled != nil {
+		fmt.Fprintln(status, summary.Stalled)
+	}
+
+	fmt.Fprintf(status, "items: %d, results: %d, failures: %d, elapsed: %s\n",
+		p.read, p.written, len(summary.Failures), SignerClock.Now().Sub(start).Truncate(time.Millisecond))
+
+	if readErr != nil {
+		return summary, readErr
+	}
+
+	if tracer != nil {
+		if err := writeTrace(tracer, opts.trace); err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, writeErr
+}
+
+func writeTrace(t *Tracer, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = t.WriteChromeTrace(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func useStubSigners(t *testing.T) {
+	useFakeClock(t)
+	DataSignerMd5 = func(data string) string { return "md5" + data + DataSignerSalt }
+	DataSignerCrc32 = crc
+	t.Cleanup(func() { DataSignerSalt = "" })
+}
+
+func TestBuildChain(t *testing.T) {
+	tests := []struct {
+		chain string
+		n     int
+		ok    bool
+	}{
+		{"single,multi,combine", 3, true},
+		{" single , count=10", 2, true},
+		{"multi,every=1s,session=500ms", 3, true},
+		{"single,md5", 0, false},
+		{"count=0", 0, false},
+		{"every=soon", 0, false},
+	}
+
+	for _, test := range tests {
+		jobs, err := buildChain(test.chain)
+		if (err == nil) != test.ok || len(jobs) != test.n {
+			t.Errorf("%q: exp %d jobs, ok %v, got %d jobs, err %v", test.chain, test.n, test.ok, len(jobs), err)
+		}
+	}
+}
+
+func TestRunCombine(t *testing.T) {
+	useStubSigners(t)
+
+	rv := []string{}
+	ExecutePipeline(source(3), SingleHash, MultiHash, CombineResults, collect(&rv))
+
+	out := new(bytes.Buffer)
+	status := new(bytes.Buffer)
+	opts := options{chain: "single,multi,combine", format: "lines"}
+
+	summary, err := runCommand(opts, []io.Reader{strings.NewReader("0\n1\n"), strings.NewReader("2")}, out, status)
+	if err != nil || len(summary.Failures) != 0 {
+		t.Fatalf("unexpected error %v %v", err, summary.Failures)
+	}
+
+	if out.String() != rv[0]+"\n" {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", out.String(), rv[0])
+	}
+
+	if !strings.Contains(status.String(), "] 3/3") || !strings.Contains(status.String(), "items: 3, results: 1, failures: 0") {
+		t.Fatalf("unexpected status %q", status.String())
+	}
+}
+
+func TestRunOrderedJSON(t *testing.T) {
+	useStubSigners(t)
+
+	// the first value is hashed last
+	release := make(chan struct{})
+	DataSignerCrc32 = func(data string) string {
+		switch data {
+		case "a":
+			<-release
+		case "c":
+			close(release)
+		}
+		return data
+	}
+
+	out := new(bytes.Buffer)
+	opts := options{chain: "single", format: "json", salt: "!", ordered: true, concurrency: 3, quiet: true}
+
+	_, err := runCommand(opts, []io.Reader{strings.NewReader("a\nb\nc\n")}, out, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		r := struct{ Result string }{}
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r.Result)
+	}
+
+	exp := []string{"a~md5a!", "b~md5b!", "c~md5c!"}
+	if strings.Join(got, " ") != strings.Join(exp, " ") {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", got, exp)
+	}
+}
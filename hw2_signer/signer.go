@@ -2,57 +2,71 @@ package main
 
 import (
 	"fmt"
-	"sort"
 	"strings"
 	"sync"
 )
 
-func hash(in, out chan interface{}, cb func(string) string) {
-	wg := sync.WaitGroup{}
+type signed struct {
+	hash string
+	err  error
+}
 
-	for i := range in {
-		wg.Add(1)
-		go func(str string) {
-			defer wg.Done()
-			out <- cb(str)
-		}(fmt.Sprintf("%v", i))
-	}
+func sign(f func() string) signed {
+	h, err := protect(func() (string, error) { return f(), nil })
+	return signed{h, err}
+}
 
-	wg.Wait()
+func hash(in, out chan interface{}, cb func(string) (string, error)) {
+	stageFor(in).process(in, out, cb)
 }
 
 func SingleHash(in, out chan interface{}) {
 	mu := sync.Mutex{}
 
-	hasher := func(data string) string {
-		ch1 := make(chan string)
-		ch2 := make(chan string)
+	hasher := func(data string) (string, error) {
+		ch1 := make(chan signed, 1)
+		ch2 := make(chan signed, 1)
 
 		go func() {
 			defer close(ch1)
 
-			ch1 <- DataSignerCrc32(data)
+			ch1 <- sign(func() string {
+				return DataSignerCrc32(data)
+			})
 		}()
 
 		go func() {
 			defer close(ch2)
 
-			mu.Lock()
-			h := DataSignerMd5(data)
-			mu.Unlock()
+			md5 := func() string {
+				mu.Lock()
+				defer mu.Unlock()
 
-			ch2 <- DataSignerCrc32(h)
+				return DataSignerMd5(data)
+			}
+
+			ch2 <- sign(func() string {
+				return DataSignerCrc32(md5())
+			})
 		}()
 
-		return fmt.Sprintf("%s~%s", <-ch1, <-ch2)
+		s1, s2 := <-ch1, <-ch2
+		if s1.err != nil {
+			return "", s1.err
+		}
+		if s2.err != nil {
+			return "", s2.err
+		}
+
+		return fmt.Sprintf("%s~%s", s1.hash, s2.hash), nil
 	}
 
 	hash(in, out, hasher)
 }
 
 func MultiHash(in, out chan interface{}) {
-	hasher := func(data string) string {
-		hash := make([]string, 6)
+	hasher := func(data string) (string, error) {
+		hash := make([]signed, 6)
 		wg := sync.WaitGroup{}
 
 		for i := range hash {
@@ -60,13 +74,23 @@ func MultiHash(in, out chan interface{}) {
 			go func(i int) {
 				defer wg.Done()
 
-				hash[i] = DataSignerCrc32(fmt.Sprintf("%d%s", i, data))
+				hash[i] = sign(func() string {
+					return DataSignerCrc32(fmt.Sprintf("%d%s", i, data))
+				})
 			}(i)
 		}
 
 		wg.Wait()
 
-		return strings.Join(hash, "")
+		rv := make([]string, len(hash))
+		for i, h := range hash {
+			if h.err != nil {
+				return "", h.err
+			}
+			rv[i] = h.hash
+		}
+
+		return strings.Join(rv, ""), nil
 
 	}
 
@@ -74,31 +98,15 @@ func MultiHash(in, out chan interface{}) {
 }
 
 func CombineResults(in, out chan interface{}) {
-	data := make([]string, 0)
+	w := newWindow(in, out)
 
 	for i := range in {
-		data = append(data, fmt.Sprint(i))
+		w.add(i)
 	}
 
-	sort.Strings(data)
-	out <- fmt.Sprint(strings.Join(data, "_"))
+	out <- w.result()
 }
 
-func ExecutePipeline(jobs ...job) {
-	chs := make([]chan interface{}, len(jobs)+1)
-	for i := 0; i < len(jobs)+1; i++ {
-		chs[i] = make(chan interface{})
-	}
-
-	wg := sync.WaitGroup{}
-	for i := range jobs {
-		wg.Add(1)
-		go func(i int, j job, in, out chan interface{}) {
-			defer wg.Done()
-			j(in, out)
-			close(out)
-		}(i, jobs[i], chs[i], chs[i+1])
-	}
-	wg.Wait()
+func ExecutePipeline(jobs ...job) Summary {
+	return (&Pipeline{}).Execute(jobs...)
 }
-
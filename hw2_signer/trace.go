@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Span struct {
+	TraceID uint64
+	Stage   string
+	Start   time.Time
+	End     time.Time
+}
+
+// Envelope carries a value through the stages together with its trace.
+// Combined results get a new trace id and keep ids of their inputs in Parents
+type Envelope struct {
+	ID      uint64
+	Value   interface{}
+	Parents []uint64
+	Spans   []Span
+
+	tracer *Tracer
+}
+
+func (e *Envelope) String() string {
+	return fmt.Sprint(e.Value)
+}
+
+func (e *Envelope) next(stage string, start time.Time, value interface{}) *Envelope {
+	span := Span{e.ID, stage, start, SignerClock.Now()}
+	e.tracer.record(span)
+
+	spans := make([]Span, len(e.Spans), len(e.Spans)+1)
+	copy(spans, e.Spans)
+
+	return &Envelope{e.ID, value, e.Parents, append(spans, span), e.tracer}
+}
+
+type Tracer struct {
+	mu    sync.Mutex
+	start time.Time
+	last  uint64
+	spans []Span
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{start: SignerClock.Now()}
+}
+
+func (t *Tracer) id() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.last++
+	return t.last
+}
+
+func (t *Tracer) record(s Span) {
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+}
+
+func (t *Tracer) envelope(v interface{}, parents []uint64) *Envelope {
+	return &Envelope{ID: t.id(), Value: v, Parents: parents, tracer: t}
+}
+
+func (t *Tracer) Spans() []Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Span(nil), t.spans...)
+}
+
+// Trace wraps every item into an Envelope with a new trace id
+func (t *Tracer) Trace() job {
+	return func(in, out chan interface{}) {
+		for v := range in {
+			out <- t.envelope(v, nil)
+		}
+	}
+}
+
+// Untrace passes the values of envelopes downstream
+func Untrace(in, out chan interface{}) {
+	for v := range in {
+		if env, ok := v.(*Envelope); ok {
+			v = env.Value
+		}
+		out <- v
+	}
+}
+
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  float64                `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// lane is a row of the trace, its spans follow one another
+type lane struct {
+	tid int
+	end time.Time
+}
+
+// WriteChromeTrace writes the spans in the trace event format understood by
+// chrome://tracing and Perfetto. Items of a stage run at once, so every stage
+// gets as many rows as it had items in flight and a span takes the first of
+// them that is free. The trace id of a span is in its args
+func (t *Tracer) WriteChromeTrace(w io.Writer) error {
+	us := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Microsecond)
+	}
+
+	spans := t.Spans()
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+
+	events := []traceEvent{}
+	lanes := map[string][]*lane{}
+	tids := 0
+	for _, s := range spans {
+		var l *lane
+		for _, free := range lanes[s.Stage] {
+			if !free.end.After(s.Start) {
+				l = free
+				break
+			}
+		}
+		if l == nil {
+			tids++
+			l = &lane{tid: tids}
+			lanes[s.Stage] = append(lanes[s.Stage], l)
+			events = append(events, traceEvent{
+				Name: "thread_name",
+				Ph:   "M",
+				Pid:  1,
+				Tid:  l.tid,
+				Args: map[string]interface{}{"name": fmt.Sprintf("%s #%d", s.Stage, len(lanes[s.Stage]))},
+			})
+		}
+		l.end = s.End
+
+		events = append(events, traceEvent{
+			Name: s.Stage,
+			Cat:  "stage",
+			Ph:   "X",
+			Ts:   us(s.Start.Sub(t.start)),
+			Dur:  us(s.End.Sub(s.Start)),
+			Pid:  1,
+			Tid:  l.tid,
+			Args: map[string]interface{}{"trace": s.TraceID},
+		})
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
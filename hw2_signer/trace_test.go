@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceEnvelope(t *testing.T) {
+	useStubSigners(t)
+
+	rv := []string{}
+	ExecutePipeline(source(3), SingleHash, MultiHash, CombineResults, collect(&rv))
+
+	tr := NewTracer()
+	var result *Envelope
+	ExecutePipeline(
+		source(3),
+		tr.Trace(),
+		SingleHash,
+		MultiHash,
+		CombineResults,
+		job(func(in, out chan interface{}) {
+			result = (<-in).(*Envelope)
+		}),
+	)
+
+	if fmt.Sprint(result) != rv[0] {
+		t.Fatalf("results not match\nGot: %v\nExpected: %v", result, rv[0])
+	}
+
+	if fmt.Sprint(len(result.Parents), result.ID) != "3 4" {
+		t.Fatalf("exp 3 parents and trace id 4, got %v %d", result.Parents, result.ID)
+	}
+
+	if len(result.Spans) != 1 || result.Spans[0].Stage != "CombineResults" {
+		t.Fatalf("unexpected combine spans %v", result.Spans)
+	}
+
+	stages := map[uint64][]string{}
+	for _, s := range tr.Spans() {
+		stages[s.TraceID] = append(stages[s.TraceID], s.Stage)
+	}
+
+	for _, id := range result.Parents {
+		if fmt.Sprint(stages[id]) != "[SingleHash MultiHash]" {
+			t.Errorf("trace %d: unexpected stages %v", id, stages[id])
+		}
+	}
+}
+
+func TestUntrace(t *testing.T) {
+	tr := NewTracer()
+	rv := []string{}
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			out <- "a"
+		}),
+		tr.Trace(),
+		Untrace,
+		collect(&rv),
+	)
+
+	if fmt.Sprint(rv) != "[a]" {
+		t.Fatalf("exp plain values, got %v", rv)
+	}
+}
+
+type chromeEvent struct {
+	Name string
+	Ph   string
+	Ts   float64
+	Dur  float64
+	Tid  int
+	Args map[string]interface{}
+}
+
+// chromeTrace writes the trace of tr and checks that every span is on a row
+// of its stage and that no two spans on a row partially overlap
+func chromeTrace(t *testing.T, tr *Tracer) []chromeEvent {
+	buf := new(bytes.Buffer)
+	if err := tr.WriteChromeTrace(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := struct {
+		TraceEvents []chromeEvent
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := map[int]string{}
+	spans := map[int][]chromeEvent{}
+	for _, e := range trace.TraceEvents {
+		switch {
+		case e.Ph == "M" && e.Name == "thread_name":
+			rows[e.Tid] = e.Args["name"].(string)
+		case e.Ph == "X" && strings.HasPrefix(rows[e.Tid], e.Name+" #"):
+			for _, p := range spans[e.Tid] {
+				pEnd, eEnd := p.Ts+p.Dur, e.Ts+e.Dur
+				if p.Ts < e.Ts && e.Ts < pEnd && pEnd < eEnd || e.Ts < p.Ts && p.Ts < eEnd && eEnd < pEnd {
+					t.Errorf("row %d: span %+v overlaps %+v", e.Tid, e, p)
+				}
+			}
+			spans[e.Tid] = append(spans[e.Tid], e)
+		default:
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+
+	return trace.TraceEvents
+}
+
+func TestWriteChromeTrace(t *testing.T) {
+	useStubSigners(t)
+
+	tr := NewTracer()
+	ExecutePipeline(source(2), tr.Trace(), SingleHash, CombineResults, Untrace, collect(&[]string{}))
+
+	names := map[string]int{}
+	traces := map[float64]bool{}
+	for _, e := range chromeTrace(t, tr) {
+		if e.Ph == "X" {
+			names[e.Name]++
+			traces[e.Args["trace"].(float64)] = true
+		}
+	}
+
+	if names["SingleHash"] != 2 || names["CombineResults"] != 1 {
+		t.Fatalf("unexpected events %v", names)
+	}
+
+	// the spans keep their trace ids
+	if len(traces) != 3 {
+		t.Fatalf("exp 3 traces, got %v", traces)
+	}
+}
+
+func TestChromeTraceLanes(t *testing.T) {
+	start := time.Unix(0, 0)
+	tr := &Tracer{start: start}
+	ms := func(n int) time.Time { return start.Add(time.Duration(n) * time.Millisecond) }
+
+	// items in flight at once, the last one starts when the first is done
+	for i, s := range [][2]int{{0, 10}, {2, 12}, {5, 6}, {10, 20}, {3, 4}} {
+		tr.record(Span{uint64(i + 1), "SingleHash", ms(s[0]), ms(s[1])})
+	}
+	tr.record(Span{6, "CombineResults", ms(20), ms(21)})
+
+	rows := map[string]map[int]bool{}
+	for _, e := range chromeTrace(t, tr) {
+		if e.Ph != "X" {
+			continue
+		}
+		if rows[e.Name] == nil {
+			rows[e.Name] = map[int]bool{}
+		}
+		rows[e.Name][e.Tid] = true
+	}
+
+	if len(rows["SingleHash"]) != 3 || len(rows["CombineResults"]) != 1 {
+		t.Fatalf("exp 3 rows of SingleHash and 1 of CombineResults, got %v", rows)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	linkRecv int32 = iota
+	linkSend
+	linkDone
+)
+
+// link relays items between two stages and remembers which side it waits for
+type link struct {
+	state int32
+}
+
+type StageState struct {
+	Name   string
+	State  string
+	Stacks string
+}
+
+type StallError struct {
+	Period time.Duration
+	Stages []StageState
+}
+
+func (e *StallError) Error() string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "pipeline stalled for %s:", e.Period)
+	for _, s := range e.Stages {
+		fmt.Fprintf(&sb, "\n\t%s: %s", s.Name, s.State)
+	}
+
+	return sb.String()
+}
+
+type watchdog struct {
+	r        *run
+	period   time.Duration
+	jobs     []job
+	names    []string
+	outs     []chan interface{}
+	last     chan interface{}
+	links    []*link
+	finished []int32
+	cancel   chan struct{}
+}
+
+// newWatchdog puts a relay between every two stages, so a stalled pipeline
+// can tell who does not send or receive and can be unblocked
+func newWatchdog(r *run, period time.Duration, jobs []job, names []string, chs []chan interface{}) *watchdog {
+	w := &watchdog{
+		r:        r,
+		period:   period,
+		jobs:     jobs,
+		names:    names,
+		outs:     make([]chan interface{}, len(jobs)),
+		last:     chs[len(jobs)],
+		links:    make([]*link, len(jobs)-1),
+		finished: make([]int32, len(jobs)),
+		cancel:   make(chan struct{}),
+	}
+
+	for i := range w.links {
+		w.outs[i] = make(chan interface{})
+		w.links[i] = &link{}
+		go w.relay(w.links[i], w.outs[i], chs[i+1])
+	}
+	w.outs[len(jobs)-1] = w.last
+
+	return w
+}
+
+func (w *watchdog) relay(l *link, src, dst chan interface{}) {
+	defer close(dst)
+
+	stop := func() {
+		atomic.StoreInt32(&l.state, linkDone)
+		drain(src)
+	}
+
+	for {
+		atomic.StoreInt32(&l.state, linkRecv)
+
+		var v interface{}
+		var ok bool
+		select {
+		case v, ok = <-src:
+			if !ok {
+				atomic.StoreInt32(&l.state, linkDone)
+				return
+			}
+		case <-w.cancel:
+			stop()
+			return
+		}
+
+		atomic.StoreInt32(&l.state, linkSend)
+		select {
+		case dst <- v:
+			w.r.tick()
+		case <-w.cancel:
+			stop()
+			return
+		}
+	}
+}
+
+func (w *watchdog) finish(i int) {
+	atomic.StoreInt32(&w.finished[i], 1)
+	w.r.tick()
+}
+
+// wait returns nil once all stages finish, or cancels the pipeline when no
+// item moved for a whole period and gives the stages one more period to exit
+func (w *watchdog) wait(wg *sync.WaitGroup) *StallError {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	last := atomic.LoadInt64(&w.r.progress)
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-SignerClock.After(w.period):
+		}
+
+		cur := atomic.LoadInt64(&w.r.progress)
+		if cur != last {
+			last = cur
+			continue
+		}
+
+		err := w.report()
+		close(w.cancel)
+		drain(w.last)
+
+		select {
+		case <-done:
+		case <-SignerClock.After(w.period):
+		}
+
+		return err
+	}
+}
+
+func (w *watchdog) state(i int, stacks string) string {
+	finished := atomic.LoadInt32(&w.finished[i]) == 1
+
+	in, out := int32(-1), int32(-1)
+	if i > 0 {
+		in = atomic.LoadInt32(&w.links[i-1].state)
+	}
+	if i < len(w.links) {
+		out = atomic.LoadInt32(&w.links[i].state)
+	}
+
+	switch {
+	case in == linkSend && finished:
+		return "finished without draining input"
+	case in == linkSend:
+		return "not receiving from " + w.names[i-1]
+	case finished:
+		return "finished"
+	case i == len(w.links) && strings.Contains(stacks, "[chan send"):
+		return "blocked on send, output is not read"
+	case out == linkSend:
+		return "blocked on send to " + w.names[i+1]
+	case in == linkRecv:
+		return "blocked on receive from " + w.names[i-1]
+	}
+
+	return "running"
+}
+
+func (w *watchdog) report() *StallError {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	goroutines := bytes.Split(buf, []byte("\n\n"))
+
+	err := &StallError{Period: w.period}
+	for i, j := range w.jobs {
+		fn := runtime.FuncForPC(reflect.ValueOf(j).Pointer()).Name()
+
+		stacks := [][]byte{}
+		for _, g := range goroutines {
+			if bytes.Contains(g, []byte(fn+"(")) {
+				stacks = append(stacks, g)
+			}
+		}
+
+		st := StageState{
+			Name:   w.names[i],
+			Stacks: string(bytes.Join(stacks, []byte("\n\n"))),
+		}
+		st.State = w.state(i, st.Stacks)
+
+		err.Stages = append(err.Stages, st)
+	}
+
+	return err
+}
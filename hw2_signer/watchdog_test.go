@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogUndrainedInput(t *testing.T) {
+	rv := []string{}
+	lazy := job(func(in, out chan interface{}) {
+		out <- "x"
+	})
+
+	p := &Pipeline{Watchdog: 50 * time.Millisecond}
+	summary := p.Execute(source(3), lazy, collect(&rv))
+
+	stall := &StallError{}
+	if !errors.As(summary.Err(), &stall) {
+		t.Fatalf("exp stall error, got %v", summary.Err())
+	}
+
+	exp := []string{
+		"blocked on send to stage1",
+		"finished without draining input",
+		"finished",
+	}
+
+	for i, s := range stall.Stages {
+		if s.State != exp[i] {
+			t.Errorf("%s: exp %q, got %q", s.Name, exp[i], s.State)
+		}
+	}
+
+	if !strings.Contains(stall.Stages[0].Stacks, "[chan send]") {
+		t.Errorf("exp source stack, got %q", stall.Stages[0].Stacks)
+	}
+
+	if len(rv) != 1 || rv[0] != "x" {
+		t.Errorf("exp output of the lazy stage, got %v", rv)
+	}
+}
+
+func TestWatchdogUnreadOutput(t *testing.T) {
+	p := &Pipeline{Watchdog: 50 * time.Millisecond}
+	summary := p.Execute(source(2), CombineResults)
+
+	if summary.Stalled == nil {
+		t.Fatalf("exp stall error")
+	}
+
+	if got := summary.Stalled.Stages[1].State; got != "blocked on send, output is not read" {
+		t.Fatalf("unexpected CombineResults state %q", got)
+	}
+}
+
+func TestWatchdogSlowProgress(t *testing.T) {
+	rv := []string{}
+	slow := job(func(in, out chan interface{}) {
+		for v := range in {
+			time.Sleep(20 * time.Millisecond)
+			out <- v
+		}
+	})
+
+	p := &Pipeline{Watchdog: 100 * time.Millisecond}
+	summary := p.Execute(source(10), slow, CombineResults, collect(&rv))
+
+	if summary.Stalled != nil {
+		t.Fatalf("unexpected stall: %s", summary.Stalled)
+	}
+
+	if len(rv) != 1 || rv[0] != "0_1_2_3_4_5_6_7_8_9" {
+		t.Fatalf("unexpected result %v", rv)
+	}
+}
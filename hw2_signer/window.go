@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+func joinSorted(data []string) string {
+	sort.Strings(data)
+	return strings.Join(data, "_")
+}
+
+// window accumulates results to combine, traced inputs make the combined
+// result an Envelope whose Parents are the input trace ids
+type window struct {
+	data []string
+	out  chan interface{}
+	name string
+
+	tracer  *Tracer
+	parents []uint64
+	start   time.Time
+}
+
+func newWindow(in, out chan interface{}) *window {
+	return &window{out: out, name: stageFor(in).name}
+}
+
+func (w *window) add(v interface{}) {
+	if env, ok := v.(*Envelope); ok {
+		if w.tracer == nil {
+			w.tracer = env.tracer
+			w.start = SignerClock.Now()
+		}
+		w.parents = append(w.parents, env.ID)
+	}
+
+	w.data = append(w.data, fmt.Sprint(v))
+}
+
+func (w *window) result() interface{} {
+	var rv interface{} = joinSorted(w.data)
+	if w.tracer != nil {
+		rv = w.tracer.envelope(nil, w.parents).next(w.name, w.start, rv)
+	}
+
+	w.data, w.tracer, w.parents = nil, nil, nil
+
+	return rv
+}
+
+func (w *window) flush() {
+	if len(w.data) == 0 {
+		return
+	}
+
+	w.out <- w.result()
+}
+
+// CombineCount emits the combined result of every n items
+func CombineCount(n int) job {
+	return func(in, out chan interface{}) {
+		w := newWindow(in, out)
+
+		for v := range in {
+			w.add(v)
+			if len(w.data) >= n {
+				w.flush()
+			}
+		}
+
+		w.flush()
+	}
+}
+
+// CombineEvery emits the combined result of the items received during each
+// interval d, empty intervals are skipped
+func CombineEvery(d time.Duration) job {
+	return func(in, out chan interface{}) {
+		w := newWindow(in, out)
+		tick := SignerClock.After(d)
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					w.flush()
+					return
+				}
+				w.add(v)
+
+			case <-tick:
+				w.flush()
+				tick = SignerClock.After(d)
+			}
+		}
+	}
+}
+
+// CombineSession emits the combined result once no item arrived for gap
+func CombineSession(gap time.Duration) job {
+	return func(in, out chan interface{}) {
+		w := newWindow(in, out)
+		timer := SignerClock.NewTimer(gap)
+		defer timer.Stop()
+
+		// the session starts with the first item
+		stop(timer)
+		var timeout <-chan time.Time
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					w.flush()
+					return
+				}
+				w.add(v)
+				stop(timer)
+				timer.Reset(gap)
+				timeout = timer.C()
+
+			case <-timeout:
+				w.flush()
+				timeout = nil
+			}
+		}
+	}
+}
+
+// stop stops t and drains a fire that was not received, so Reset does not
+// leave a stale value in C
+func stop(t Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C():
+		default:
+		}
+	}
+}
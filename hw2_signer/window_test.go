@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// start runs a single job, so a send returns once the job has received the value
+func start(j job) (chan interface{}, chan interface{}) {
+	in := make(chan interface{})
+	out := make(chan interface{})
+
+	go func() {
+		j(in, out)
+		close(out)
+	}()
+
+	return in, out
+}
+
+func expect(t *testing.T, res chan interface{}, exp string) {
+	select {
+	case got := <-res:
+		if got != exp {
+			t.Fatalf("exp window %q, got %q", exp, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("window %q was not emitted", exp)
+	}
+}
+
+// blockUntilDeadline waits until the only sleeper on the clock wakes at at
+func blockUntilDeadline(t *testing.T, clk *FakeClock, at time.Time) {
+	deadline := time.After(time.Second)
+	for {
+		clk.mu.Lock()
+		ok := len(clk.waiters) == 1 && clk.waiters[0].at.Equal(at)
+		ch := clk.changed
+		clk.mu.Unlock()
+		if ok {
+			return
+		}
+
+		select {
+		case <-ch:
+		case <-deadline:
+			t.Fatalf("expected 1 sleeper until %s, got %d", at, clk.Waiters())
+		}
+	}
+}
+
+func TestCombineCount(t *testing.T) {
+	rv := []string{}
+	ExecutePipeline(source(8), CombineCount(3), collect(&rv))
+
+	if fmt.Sprint(rv) != "[0_1_2 3_4_5 6_7]" {
+		t.Fatalf("unexpected windows %v", rv)
+	}
+}
+
+func TestCombineEvery(t *testing.T) {
+	clk := useFakeClock(t)
+	src, res := start(CombineEvery(time.Second))
+
+	blockUntil(t, clk, 1)
+	src <- "b"
+	src <- "a"
+	clk.Advance(time.Second)
+	expect(t, res, "a_b")
+
+	// an empty window emits nothing
+	blockUntil(t, clk, 1)
+	clk.Advance(time.Second)
+
+	src <- "c"
+	close(src)
+	expect(t, res, "c")
+
+	if _, ok := <-res; ok {
+		t.Fatalf("exp no more windows")
+	}
+}
+
+func TestCombineSession(t *testing.T) {
+	clk := useFakeClock(t)
+	src, res := start(CombineSession(time.Second))
+
+	src <- "b"
+	blockUntil(t, clk, 1)
+	clk.Advance(500 * time.Millisecond)
+
+	src <- "a"
+	blockUntilDeadline(t, clk, clk.Now().Add(time.Second))
+	clk.Advance(900 * time.Millisecond)
+
+	select {
+	case got := <-res:
+		t.Fatalf("session closed too early: %q", got)
+	default:
+	}
+
+	clk.Advance(100 * time.Millisecond)
+	expect(t, res, "a_b")
+
+	src <- "d"
+	src <- "c"
+	close(src)
+	expect(t, res, "c_d")
+}
+
+func TestCombineSessionTimer(t *testing.T) {
+	clk := useFakeClock(t)
+	src, res := start(CombineSession(time.Second))
+
+	// every item moves the single timer of the session
+	for i := 0; i < 10; i++ {
+		src <- fmt.Sprint(i)
+		blockUntilDeadline(t, clk, clk.Now().Add(time.Second))
+		clk.Advance(100 * time.Millisecond)
+	}
+
+	clk.Advance(900 * time.Millisecond)
+	expect(t, res, "0_1_2_3_4_5_6_7_8_9")
+
+	if clk.Waiters() != 0 {
+		t.Fatalf("exp no sleepers after the session, got %d", clk.Waiters())
+	}
+
+	close(src)
+	if _, ok := <-res; ok {
+		t.Fatalf("exp no more windows")
+	}
+}
@@ -0,0 +1,163 @@
+// Package aho finds which of a set of patterns occur in a string in one pass
+// with the Aho-Corasick automaton
+package aho
+
+// Matcher is a deterministic automaton over byte classes: the bytes that are
+// not in any pattern share class 0, so the transition table has a row of
+// a few dozen entries per state instead of 256.
+//
+// A transition is the offset of the row of the next state, negated with ^
+// when some pattern ends in that state, so the loop over the input needs no
+// other lookups until a hit
+type Matcher struct {
+	n       int
+	words   int
+	classes int
+	class   [256]int32
+	delta   []int32
+	// out has the words of the patterns ending in a state, including the ones
+	// ending in its suffixes
+	out []uint64
+}
+
+// New builds the matcher, pattern i sets bit i%64 of word i/64 of the hits
+func New(patterns []string) *Matcher {
+	m := &Matcher{n: len(patterns), words: (len(patterns) + 63) / 64}
+
+	for _, p := range patterns {
+		for i := 0; i < len(p); i++ {
+			c := p[i]
+			if m.class[c] == 0 {
+				m.classes++
+				m.class[c] = int32(m.classes)
+			}
+		}
+	}
+	m.classes++
+
+	// the trie, -1 is no edge yet
+	m.addState()
+	for i, p := range patterns {
+		s := int32(0)
+		for j := 0; j < len(p); j++ {
+			e := int(s)*m.classes + int(m.class[p[j]])
+			if m.delta[e] < 0 {
+				// adding a state may move delta
+				next := m.addState()
+				m.delta[e] = next
+			}
+			s = m.delta[e]
+		}
+		m.out[int(s)*m.words+i/64] |= 1 << (i % 64)
+	}
+
+	// breadth first the missing edges go where the failure link goes, which
+	// is already complete, and the outputs of the failure link are added
+	fail := make([]int32, len(m.delta)/m.classes)
+	queue := []int32{}
+	for c := 0; c < m.classes; c++ {
+		if m.delta[c] < 0 {
+			m.delta[c] = 0
+		} else {
+			queue = append(queue, m.delta[c])
+		}
+	}
+
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		m.or(fail[s], m.row(s))
+
+		for c := 0; c < m.classes; c++ {
+			e := int(s)*m.classes + c
+			f := m.delta[int(fail[s])*m.classes+c]
+			if m.delta[e] < 0 {
+				m.delta[e] = f
+			} else {
+				fail[m.delta[e]] = f
+				queue = append(queue, m.delta[e])
+			}
+		}
+	}
+
+	for i, s := range m.delta {
+		m.delta[i] = s * int32(m.classes)
+		if m.hit(s) {
+			m.delta[i] = ^m.delta[i]
+		}
+	}
+
+	return m
+}
+
+func (m *Matcher) addState() int32 {
+	s := int32(len(m.delta) / m.classes)
+	for c := 0; c < m.classes; c++ {
+		m.delta = append(m.delta, -1)
+	}
+	m.out = append(m.out, make([]uint64, m.words)...)
+	return s
+}
+
+func (m *Matcher) row(s int32) []uint64 {
+	return m.out[int(s)*m.words : int(s+1)*m.words]
+}
+
+func (m *Matcher) hit(s int32) bool {
+	for _, w := range m.row(s) {
+		if w != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) or(s int32, hits []uint64) {
+	for i, w := range m.row(s) {
+		hits[i] |= w
+	}
+}
+
+// Len is the number of patterns
+func (m *Matcher) Len() int {
+	return m.n
+}
+
+// Words is the length of the hits slice for Match
+func (m *Matcher) Words() int {
+	return m.words
+}
+
+// Match sets the bits of the patterns found in s in hits, which must be at
+// least Words long. Bits already set are kept
+func (m *Matcher) Match(s string, hits []uint64) {
+	// empty patterns end in the start state
+	m.or(0, hits)
+
+	st := int32(0)
+	for i := 0; i < len(s); i++ {
+		st = m.delta[st+m.class[s[i]]]
+		if st < 0 {
+			st = ^st
+			m.or(st/int32(m.classes), hits)
+		}
+	}
+}
+
+// Match64 returns the hits of the first 64 patterns
+func (m *Matcher) Match64(s string) uint64 {
+	if m.words == 0 {
+		return 0
+	}
+
+	hits := m.out[0]
+	st := int32(0)
+	for i := 0; i < len(s); i++ {
+		st = m.delta[st+m.class[s[i]]]
+		if st < 0 {
+			st = ^st
+			hits |= m.out[int(st)/m.classes*m.words]
+		}
+	}
+	return hits
+}
@@ -0,0 +1,147 @@
+package aho
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func naive(patterns []string, s string) []uint64 {
+	hits := make([]uint64, (len(patterns)+63)/64)
+	for i, p := range patterns {
+		if strings.Contains(s, p) {
+			hits[i/64] |= 1 << (i % 64)
+		}
+	}
+	return hits
+}
+
+func equal(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		input    string
+		exp      uint64
+	}{
+		{[]string{"he", "she", "his", "hers"}, "ushers", 0b1011},
+		{[]string{"he", "she", "his", "hers"}, "ahishers", 0b1111},
+		{[]string{"he", "she", "his", "hers"}, "", 0},
+		{[]string{"Android", "MSIE"}, "Mozilla/5.0 (Linux; Android 4.0)", 0b01},
+		{[]string{"Android", "MSIE"}, "Mozilla/4.0 (compatible; MSIE 8.0; Android)", 0b11},
+		{[]string{"a", "aa", "aaa"}, "aa", 0b011},
+		{[]string{"", "x"}, "abc", 0b01},
+		{[]string{"abcd", "bc", "c"}, "abc", 0b110},
+		{[]string{"same", "same"}, "the same", 0b11},
+		{nil, "anything", 0},
+	}
+
+	for _, tt := range tests {
+		m := New(tt.patterns)
+		if got := m.Match64(tt.input); got != tt.exp {
+			t.Errorf("%q in %q: expected %b, got %b", tt.patterns, tt.input, tt.exp, got)
+		}
+	}
+}
+
+func TestMatchRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	str := func(n int) string {
+		b := make([]byte, r.Intn(n))
+		for i := range b {
+			b[i] = "abc\x00\xff"[r.Intn(5)]
+		}
+		return string(b)
+	}
+
+	for i := 0; i < 500; i++ {
+		patterns := make([]string, 1+r.Intn(150))
+		for j := range patterns {
+			patterns[j] = str(6)
+		}
+		m := New(patterns)
+
+		for j := 0; j < 20; j++ {
+			s := str(40)
+			hits := make([]uint64, m.Words())
+			m.Match(s, hits)
+			if exp := naive(patterns, s); !equal(hits, exp) {
+				t.Fatalf("%q in %q: expected %b, got %b", patterns, s, exp, hits)
+			}
+			if m.Match64(s) != hits[0] {
+				t.Fatalf("%q in %q: Match64 differs from Match", patterns, s)
+			}
+		}
+	}
+}
+
+func TestAllBytes(t *testing.T) {
+	patterns := make([]string, 256)
+	for i := range patterns {
+		patterns[i] = string([]byte{byte(i), byte(255 - i)})
+	}
+	m := New(patterns)
+
+	s := "\x00\xff\x10"
+	hits := make([]uint64, m.Words())
+	m.Match(s, hits)
+	if exp := naive(patterns, s); !equal(hits, exp) {
+		t.Errorf("expected %b, got %b", exp, hits)
+	}
+}
+
+func TestMatchAllocs(t *testing.T) {
+	m := New([]string{"Android", "MSIE", "Opera", "Chrome"})
+	hits := make([]uint64, m.Words())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Match("Mozilla/5.0 (Linux; Android 4.0) Chrome/30", hits)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+var benchUA = "Mozilla/5.0 (Linux; U; Android 4.0.3; ko-kr; LG-L160L Build/IML74K) AppleWebKit/534.30 (KHTML, like Gecko) Version/4.0 Mobile Safari/534.30"
+
+var benchPatterns = []string{
+	"Android", "MSIE", "Opera", "Chrome", "Firefox", "iPad", "iPhone", "Windows NT",
+	"Symbian", "BlackBerry", "Trident", "Presto", "Kindle", "Silk", "Puffin", "Konqueror",
+}
+
+func BenchmarkMatch(b *testing.B) {
+	for _, n := range []int{2, 4, 8, 16} {
+		patterns := benchPatterns[:n]
+
+		b.Run(fmt.Sprintf("%d/contains", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hits := uint64(0)
+				for j, p := range patterns {
+					if strings.Contains(benchUA, p) {
+						hits |= 1 << j
+					}
+				}
+			}
+			b.SetBytes(int64(len(benchUA)))
+		})
+
+		b.Run(fmt.Sprintf("%d/aho", n), func(b *testing.B) {
+			m := New(patterns)
+			for i := 0; i < b.N; i++ {
+				m.Match64(benchUA)
+			}
+			b.SetBytes(int64(len(benchUA)))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// usersd serves the searches over a users file:
+//
+//	go run ./cmd/usersd -file ./data/users.txt
+//	curl 'localhost:8083/search?expr=browser~"Android"&format=json&limit=10'
+//	curl localhost:8083/stats
+package main
+
+import (
+	"coursera-go/hw3_bench/fast"
+	"coursera-go/hw3_bench/server"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8083", "listen address")
+	file := flag.String("file", "./data/users.txt", "users file, plain, gzip or bzip2")
+	index := flag.String("index", "", "index path, the file with .idx if empty")
+	reload := flag.Duration("reload", time.Second, "how often the file is checked for changes")
+	redact := flag.String("redact", "", "policies as field=policy,... for name, email and phone")
+	salt := flag.String("salt", "", "key of the hash policy")
+	flag.Parse()
+
+	policies, err := parseRedact(*redact)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c := server.Config{
+		Path:   *file,
+		Index:  *index,
+		Reload: *reload,
+		Redact: policies,
+		Salt:   *salt,
+	}
+	if err := run(*addr, c); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves until the listener fails, the server is closed before the error
+// is returned
+func run(addr string, c server.Config) error {
+	s, err := server.New(c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("starting server at", addr)
+	err = http.ListenAndServe(addr, s)
+	s.Close()
+	return err
+}
+
+func parseRedact(s string) (map[string]fast.Policy, error) {
+	rv := map[string]fast.Policy{}
+	if s == "" {
+		return rv, nil
+	}
+
+	for _, kv := range strings.Split(s, ",") {
+		field, name, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad redaction %q, expected field=policy", kv)
+		}
+		p, err := fast.ParsePolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		rv[field] = p
+	}
+	return rv, nil
+}
@@ -1,26 +1,32 @@
 package main
 
 import (
+	"coursera-go/hw3_bench/fast"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"regexp"
 	"strings"
 	// "log"
 )
 
-const filePath string = "./data/users.txt"
+// filePath may be plain, gzip or bzip2
+var filePath = "./data/users.txt"
 
-func SlowSearch(out io.Writer) {
-	file, err := os.Open(filePath)
+func SlowSearch(out io.Writer) error {
+	file, err := fast.Open(filePath)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer file.Close()
 
+	return slowSearch(file, out)
+}
+
+func slowSearch(file io.Reader, out io.Writer) error {
 	fileContents, err := io.ReadAll(file)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	r := regexp.MustCompile("@")
@@ -28,15 +34,15 @@ func SlowSearch(out io.Writer) {
 	uniqueBrowsers := 0
 	foundUsers := ""
 
-	lines := strings.Split(string(fileContents), "\n")
+	lines := strings.Split(strings.TrimSuffix(string(fileContents), "\n"), "\n")
 
 	users := make([]map[string]interface{}, 0)
-	for _, line := range lines {
+	for i, line := range lines {
 		user := make(map[string]interface{})
 		// fmt.Printf("%v %v\n", err, line)
 		err := json.Unmarshal([]byte(line), &user)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("line %d: %w", i, err)
 		}
 		users = append(users, user)
 	}
@@ -106,5 +112,6 @@ func SlowSearch(out io.Writer) {
 	}
 
 	fmt.Fprintln(out, "found users:\n"+foundUsers)
-	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+	_, err = fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+	return err
 }
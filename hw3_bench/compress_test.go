@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchCompressedFile(t *testing.T) {
+	exp := new(bytes.Buffer)
+	if err := SlowSearch(exp); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := new(bytes.Buffer)
+	zw := gzip.NewWriter(gz)
+	zw.Write(data)
+	zw.Close()
+
+	path := filepath.Join(t.TempDir(), "users.txt.gz")
+	if err := os.WriteFile(path, gz.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(p string) { filePath = p }(filePath)
+	filePath = path
+
+	searches := map[string]func(out io.Writer) error{
+		"slow":     SlowSearch,
+		"fast":     FastSearch,
+		"easyjson": FastSearchEasyJson,
+		"parallel": FastSearchParallel,
+	}
+
+	for name, search := range searches {
+		out := new(bytes.Buffer)
+		if err := search(out); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.String() != exp.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, out, exp)
+		}
+	}
+}
@@ -3,25 +3,39 @@ package main
 import (
 	"coursera-go/hw3_bench/fast"
 	"io"
-	"os"
 )
 
-func FastSearch(out io.Writer) {
-	data, err := os.ReadFile(filePath)
-
+func FastSearch(out io.Writer) error {
+	file, err := fast.Open(filePath)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer file.Close()
 
-	fast.Default(out, data)
+	return fast.Search(file, out)
 }
 
-func FastSearchEasyJson(out io.Writer) {
-	data, err := os.ReadFile(filePath)
+func FastSearchEasyJson(out io.Writer) error {
+	file, err := fast.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	return fast.EasyJson(out, data)
+}
 
+func FastSearchParallel(out io.Writer) error {
+	file, err := fast.Open(filePath)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer file.Close()
 
-	fast.EasyJson(out, data)
+	return fast.SearchParallel(file, out, 0)
 }
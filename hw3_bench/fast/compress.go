@@ -0,0 +1,302 @@
+package fast
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+)
+
+// Open opens a users file, plain or compressed
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, closer, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return readCloser{r, func() error {
+		closer()
+		return f.Close()
+	}}, nil
+}
+
+// NewReader detects gzip and bzip2 by the magic bytes and decompresses r
+// while it is read, other input is returned as is. Gzip members with the
+// size of the member in the header, as written by bgzip, are decompressed
+// in parallel. Close stops the decompression, it does not close r
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	rd, closer, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{rd, closer}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+func nop() error { return nil }
+
+// decompress returns the buffered plain input itself, so that lineReader
+// does not buffer it again
+func decompress(r io.Reader) (io.Reader, func() error, error) {
+	// already decompressed by Open or NewReader
+	if rc, ok := r.(readCloser); ok {
+		return rc.Reader, nop, nil
+	}
+
+	br := bufio.NewReaderSize(r, readerSize)
+
+	head, err := br.Peek(len(bzip2Magic))
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		if bgzfSize(br) >= 0 {
+			pr := newParallelGzip(br)
+			return pr, pr.close, nil
+		}
+
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+
+	case bytes.HasPrefix(head, bzip2Magic):
+		return bzip2.NewReader(br), nop, nil
+	}
+
+	return br, nop, nil
+}
+
+// compressed tells if the data starts like a compressed input
+func compressed(head []byte) bool {
+	return bytes.HasPrefix(head, gzipMagic) || bytes.HasPrefix(head, bzip2Magic)
+}
+
+const (
+	gzipHeaderSize = 10
+	gzipFlagExtra  = 1 << 2
+
+	// the header with a single BC subfield of bgzip: XLEN 6, 'B', 'C', SLEN 2
+	// and the size of the member minus one
+	bgzfHeaderSize = gzipHeaderSize + 8
+)
+
+// bgzfSize returns the size of the gzip member at the start of br, -1 if it
+// does not have it in the header
+func bgzfSize(br *bufio.Reader) int {
+	h, err := br.Peek(bgzfHeaderSize)
+	if err != nil || h[0] != gzipMagic[0] || h[1] != gzipMagic[1] || h[3]&gzipFlagExtra == 0 {
+		return -1
+	}
+
+	x := h[gzipHeaderSize:]
+	if binary.LittleEndian.Uint16(x) != 6 || x[2] != 'B' || x[3] != 'C' || binary.LittleEndian.Uint16(x[4:]) != 2 {
+		return -1
+	}
+
+	return int(binary.LittleEndian.Uint16(x[6:])) + 1
+}
+
+// parallelGzip reads the members one after another and inflates them on
+// GOMAXPROCS goroutines, blocks keeps them in order. A member without the
+// size ends the parallel part, it and the rest of the input are read by
+// gzip.Reader. The blocks and their buffers are reused through free
+type parallelGzip struct {
+	blocks chan *gzipBlock
+	free   chan *gzipBlock
+	stop   chan struct{}
+	cur    *gzipBlock
+	off    int
+	err    error
+}
+
+type gzipBlock struct {
+	in   []byte
+	out  []byte
+	rest io.Reader
+	err  error
+	done chan struct{}
+}
+
+func newParallelGzip(br *bufio.Reader) *parallelGzip {
+	workers := runtime.GOMAXPROCS(0)
+	p := &parallelGzip{
+		blocks: make(chan *gzipBlock, 2*workers),
+		free:   make(chan *gzipBlock, 2*workers),
+		stop:   make(chan struct{}),
+	}
+	for i := 0; i < cap(p.free); i++ {
+		p.free <- &gzipBlock{}
+	}
+
+	// neither blocks nor todo can fill up, there are only cap(free) blocks
+	todo := make(chan *gzipBlock, cap(p.free))
+	for i := 0; i < workers; i++ {
+		go inflate(todo)
+	}
+
+	go p.read(br, todo)
+	return p
+}
+
+func (p *parallelGzip) read(br *bufio.Reader, todo chan<- *gzipBlock) {
+	defer close(p.blocks)
+	defer close(todo)
+
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return
+		}
+
+		var b *gzipBlock
+		select {
+		case b = <-p.free:
+		case <-p.stop:
+			return
+		}
+		b.done = make(chan struct{})
+		b.rest, b.err = nil, nil
+
+		// b.err is written by inflate, last tells if b ends the input
+		last := true
+		if size := bgzfSize(br); size >= 0 {
+			b.in = slices.Grow(b.in[:0], size)[:size]
+			if _, err := io.ReadFull(br, b.in); err != nil {
+				b.err = err
+				close(b.done)
+			} else {
+				last = false
+				todo <- b
+			}
+		} else {
+			b.rest, b.err = gzip.NewReader(br)
+			close(b.done)
+		}
+
+		p.blocks <- b
+		if last {
+			return
+		}
+	}
+}
+
+func inflate(todo <-chan *gzipBlock) {
+	in := &bytes.Reader{}
+	var zr *gzip.Reader
+
+	for b := range todo {
+		in.Reset(b.in)
+
+		var err error
+		if zr == nil {
+			zr, err = gzip.NewReader(in)
+		} else {
+			err = zr.Reset(in)
+		}
+
+		if err == nil {
+			zr.Multistream(false)
+			b.out, err = readAll(zr, b.out[:0])
+		}
+		if err == nil && in.Len() > 0 {
+			err = errors.New("gzip: member is shorter than its size in the header")
+		}
+
+		b.err = err
+		close(b.done)
+	}
+}
+
+// readAll is io.ReadAll into b
+func readAll(r io.Reader, b []byte) ([]byte, error) {
+	for {
+		if len(b) == cap(b) {
+			b = slices.Grow(b, 1<<16)
+		}
+
+		n, err := r.Read(b[len(b):cap(b)])
+		b = b[:len(b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return b, err
+		}
+	}
+}
+
+func (p *parallelGzip) Read(buf []byte) (int, error) {
+	for p.err == nil {
+		if p.cur == nil {
+			b, ok := <-p.blocks
+			if !ok {
+				p.err = io.EOF
+				break
+			}
+			<-b.done
+			p.cur, p.off = b, 0
+		}
+
+		b := p.cur
+		if b.err != nil {
+			p.err = b.err
+			break
+		}
+
+		if b.rest != nil {
+			n, err := b.rest.Read(buf)
+			if err != nil {
+				p.err = err
+			}
+			return n, err
+		}
+
+		if p.off < len(b.out) {
+			n := copy(buf, b.out[p.off:])
+			p.off += n
+			return n, nil
+		}
+
+		p.cur = nil
+		p.free <- b
+	}
+
+	return 0, p.err
+}
+
+func (p *parallelGzip) close() error {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	return nil
+}
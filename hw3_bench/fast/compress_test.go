@@ -0,0 +1,199 @@
+package fast
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gzipData(tb testing.TB, data []byte) []byte {
+	out := new(bytes.Buffer)
+	zw := gzip.NewWriter(out)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// bgzfData writes the data as gzip members of up to size bytes with the size
+// of the member in the header like bgzip
+func bgzfData(tb testing.TB, data []byte, size int) []byte {
+	out := []byte{}
+	for len(data) > 0 {
+		n := min(size, len(data))
+
+		member := new(bytes.Buffer)
+		zw := gzip.NewWriter(member)
+		zw.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		zw.Write(data[:n])
+		if err := zw.Close(); err != nil {
+			tb.Fatal(err)
+		}
+
+		m := member.Bytes()
+		binary.LittleEndian.PutUint16(m[bgzfHeaderSize-2:], uint16(len(m)-1))
+		out = append(out, m...)
+		data = data[n:]
+	}
+	return out
+}
+
+func TestCompressedSearch(t *testing.T) {
+	data := userData(t)
+	bz, err := os.ReadFile("testdata/users.txt.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := new(bytes.Buffer)
+	if err := Search(bytes.NewReader(data), exp); err != nil {
+		t.Fatal(err)
+	}
+
+	half := len(data) / 2
+	inputs := map[string][]byte{
+		"gzip":    gzipData(t, data),
+		"members": append(gzipData(t, data[:half]), gzipData(t, data[half:])...),
+		"bgzf":    bgzfData(t, data, 10000),
+		"mixed":   append(bgzfData(t, data[:half], 5000), gzipData(t, data[half:])...),
+		"bzip2":   bz,
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			got := new(bytes.Buffer)
+			if err := Search(bytes.NewReader(input), got); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != exp.String() {
+				t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, exp)
+			}
+
+			got.Reset()
+			if err := SearchParallel(bytes.NewReader(input), got, 4); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != exp.String() {
+				t.Errorf("parallel results not match\nGot:\n%v\nExpected:\n%v", got, exp)
+			}
+
+			r, err := NewReader(bytes.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			plain, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(plain, data) {
+				t.Error("decompressed data differs")
+			}
+		})
+	}
+}
+
+func TestCompressedErrors(t *testing.T) {
+	data := []byte(strings.Repeat(`{"browsers":["Android","MSIE"],"name":"a","email":"a@b"}`+"\n", 100))
+
+	truncated := bgzfData(t, data, 1000)
+	truncated = truncated[:len(truncated)-10]
+
+	// the size in the header of the second member is one byte too big
+	wrong := bgzfData(t, data, 1000)
+	first := int(binary.LittleEndian.Uint16(wrong[bgzfHeaderSize-2:])) + 1
+	binary.LittleEndian.PutUint16(wrong[first+bgzfHeaderSize-2:], binary.LittleEndian.Uint16(wrong[first+bgzfHeaderSize-2:])+1)
+
+	inputs := map[string][]byte{
+		"gzip":      gzipData(t, data)[:50],
+		"truncated": truncated,
+		"size":      wrong,
+		"garbage":   append(bgzfData(t, data, 1000), "garbage"...),
+		"bzip2":     []byte("BZh9 not really"),
+	}
+
+	for name, input := range inputs {
+		if err := Search(bytes.NewReader(input), io.Discard); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if err := SearchParallel(bytes.NewReader(input), io.Discard, 2); err == nil {
+			t.Errorf("%s: expected parallel error", name)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	data := userData(t)
+	path := filepath.Join(t.TempDir(), "users.txt.gz")
+	if err := os.WriteFile(path, bgzfData(t, data, 1<<16-1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, data) {
+		t.Error("decompressed data differs")
+	}
+
+	// closing early stops the decompression
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Read(make([]byte, 10))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := BuildIndex(path); !errors.Is(err, ErrCompressed) {
+		t.Error("expected error for indexing a compressed file")
+	}
+}
+
+func BenchmarkSearchCompressed(b *testing.B) {
+	data := bytes.Repeat(append(userData(b), '\n'), 64)
+
+	inputs := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", data},
+		{"gzip", gzipData(b, data)},
+		{"bgzf", bgzfData(b, data, 1<<16-1024)},
+	}
+
+	for _, in := range inputs {
+		b.Run(in.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := Search(bytes.NewReader(in.data), io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.SetBytes(int64(len(data)))
+		})
+	}
+}
+
+func userData(tb testing.TB) []byte {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
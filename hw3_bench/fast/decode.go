@@ -0,0 +1,580 @@
+package fast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// same limit as encoding/json
+const maxDepth = 10000
+
+const allFields = 1<<(fieldBrowser+1) - 1
+
+// keys of the User fields for the case insensitive match of encoding/json,
+// exact matches are handled by the switch in key
+var keys = []struct {
+	name  string
+	field int
+}{
+	{"browsers", fieldBrowser},
+	{"company", fieldCompany},
+	{"country", fieldCountry},
+	{"email", fieldEmail},
+	{"job", fieldJob},
+	{"name", fieldName},
+	{"phone", fieldPhone},
+}
+
+// decoder is a hand written replacement for User.UnmarshalJSON that fills only
+// the fields in mask and skips the rest without allocating. Strings point into
+// the line when they have no escapes and into buf otherwise, so like the
+// nocopy easyjson fields they are valid until the next decode.
+//
+// The input is validated as a whole and the decoded fields follow
+// encoding/json, type errors are reported only for the fields in mask
+type decoder struct {
+	mask uint
+	buf  []byte
+	data []byte
+	pos  int
+
+	// plain lines have no escapes and nothing to validate in strings, which
+	// is checked once for the whole line instead of for every string
+	plain bool
+}
+
+func newDecoder(mask uint) *decoder {
+	return &decoder{mask: mask}
+}
+
+func (d *decoder) decode(data []byte, u *User) error {
+	d.data, d.pos, d.buf = data, 0, d.buf[:0]
+	d.plain = plain(data)
+
+	d.ws()
+	if d.null() {
+		return d.end()
+	}
+
+	if !d.next('{') {
+		if err := d.skip(0); err != nil {
+			return err
+		}
+		return d.errorf("cannot unmarshal non object into User")
+	}
+
+	d.ws()
+	if d.next('}') {
+		return d.end()
+	}
+
+	for {
+		d.ws()
+		field, err := d.key()
+		if err != nil {
+			return err
+		}
+
+		d.ws()
+		if !d.next(':') {
+			return d.errorf("expected ':' after object key")
+		}
+		d.ws()
+
+		switch {
+		case field < 0 || d.mask&(1<<field) == 0:
+			err = d.skip(0)
+		case field == fieldBrowser:
+			err = d.browsers(u)
+		case d.null():
+		default:
+			var s string
+			if s, err = d.str(); err == nil {
+				*u.fieldPtr(field) = s
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		d.ws()
+		if d.next('}') {
+			return d.end()
+		}
+		if !d.next(',') {
+			return d.errorf("expected ',' or '}' after object value")
+		}
+	}
+}
+
+func (u *User) fieldPtr(f int) *string {
+	switch f {
+	case fieldName:
+		return &u.Name
+	case fieldEmail:
+		return &u.Email
+	case fieldCompany:
+		return &u.Company
+	case fieldCountry:
+		return &u.Country
+	case fieldJob:
+		return &u.Job
+	}
+	return &u.Phone
+}
+
+// browsers reuses the backing array of u.Browsers. As in encoding/json a
+// null element leaves the old value of that element in place
+func (d *decoder) browsers(u *User) error {
+	if d.null() {
+		u.Browsers = nil
+		return nil
+	}
+
+	if !d.next('[') {
+		return d.typeError("browsers")
+	}
+	u.Browsers = u.Browsers[:0]
+
+	d.ws()
+	if d.next(']') {
+		return nil
+	}
+
+	for {
+		d.ws()
+		switch {
+		case d.null():
+			if len(u.Browsers) < cap(u.Browsers) {
+				u.Browsers = u.Browsers[:len(u.Browsers)+1]
+			} else {
+				u.Browsers = append(u.Browsers, "")
+			}
+
+		default:
+			s, err := d.str()
+			if err != nil {
+				return err
+			}
+			u.Browsers = append(u.Browsers, s)
+		}
+
+		d.ws()
+		if d.next(']') {
+			return nil
+		}
+		if !d.next(',') {
+			return d.errorf("expected ',' or ']' after array element")
+		}
+	}
+}
+
+// key returns the field of the object key or -1 for unknown keys
+func (d *decoder) key() (int, error) {
+	if d.pos == len(d.data) || d.data[d.pos] != '"' {
+		return 0, d.errorf("expected object key")
+	}
+
+	start := len(d.buf)
+	k, err := d.str()
+	if err != nil {
+		return 0, err
+	}
+	d.buf = d.buf[:start]
+
+	switch k {
+	case "browsers":
+		return fieldBrowser, nil
+	case "company":
+		return fieldCompany, nil
+	case "country":
+		return fieldCountry, nil
+	case "email":
+		return fieldEmail, nil
+	case "job":
+		return fieldJob, nil
+	case "name":
+		return fieldName, nil
+	case "phone":
+		return fieldPhone, nil
+	}
+
+	for _, key := range keys {
+		if bytes.EqualFold(unsafe.Slice(unsafe.StringData(k), len(k)), []byte(key.name)) {
+			return key.field, nil
+		}
+	}
+
+	return -1, nil
+}
+
+// str reads a string value, other types are type errors
+func (d *decoder) str() (string, error) {
+	if d.pos == len(d.data) || d.data[d.pos] != '"' {
+		return "", d.skipTypeError()
+	}
+
+	data := d.data
+	start := d.pos + 1
+
+	end := bytes.IndexByte(data[start:], '"')
+	if end < 0 {
+		d.pos = len(data)
+		return "", d.errorf("unexpected end of string")
+	}
+	end += start
+
+	if !d.plain && !plain(data[start:end]) {
+		return d.unquote(start, start)
+	}
+
+	d.pos = end + 1
+	return toString(data[start:end]), nil
+}
+
+const (
+	lo = 0x0101010101010101
+	hi = 0x8080808080808080
+)
+
+// plain reports whether b has no backslash, control or non ASCII characters,
+// 8 bytes at a time
+func plain(b []byte) bool {
+	for len(b) >= 16 {
+		if special(binary.LittleEndian.Uint64(b))|special(binary.LittleEndian.Uint64(b[8:])) != 0 {
+			return false
+		}
+		b = b[16:]
+	}
+
+	for len(b) >= 8 {
+		if special(binary.LittleEndian.Uint64(b)) != 0 {
+			return false
+		}
+		b = b[8:]
+	}
+
+	for _, c := range b {
+		if c < ' ' || c >= utf8.RuneSelf || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// special sets the high bit of the bytes of x that are backslashes, control
+// or non ASCII characters. A byte below 0x20 or a zero byte after the xor
+// borrows into its high bit, the borrow into the next byte only matters when
+// the first one was a hit already
+func special(x uint64) uint64 {
+	y := x ^ lo*'\\'
+	return ((x - lo*' ') | x | ((y - lo) &^ y)) & hi
+}
+
+// unquote is the slow path of str, the string from start to i is plain
+func (d *decoder) unquote(start, i int) (string, error) {
+	data := d.data
+	b := len(d.buf)
+	d.buf = append(d.buf, data[start:i]...)
+
+	for i < len(data) {
+		c := data[i]
+
+		switch {
+		case c == '"':
+			d.pos = i + 1
+			return toString(d.buf[b:]), nil
+
+		case c < ' ':
+			d.pos = i
+			return "", d.errorf("invalid character %q in string", c)
+
+		case c == '\\':
+			if i+1 == len(data) {
+				d.pos = i
+				return "", d.errorf("unexpected end of string")
+			}
+
+			switch e := data[i+1]; e {
+			case '"', '\\', '/':
+				d.buf = append(d.buf, e)
+			case 'b':
+				d.buf = append(d.buf, '\b')
+			case 'f':
+				d.buf = append(d.buf, '\f')
+			case 'n':
+				d.buf = append(d.buf, '\n')
+			case 'r':
+				d.buf = append(d.buf, '\r')
+			case 't':
+				d.buf = append(d.buf, '\t')
+
+			case 'u':
+				r, ok := hex4(data[i+2:])
+				if !ok {
+					d.pos = i
+					return "", d.errorf("invalid unicode escape")
+				}
+
+				if utf16.IsSurrogate(r) {
+					r2, ok := rune(-1), false
+					if i+7 < len(data) && data[i+6] == '\\' && data[i+7] == 'u' {
+						r2, ok = hex4(data[i+8:])
+					}
+
+					if dec := utf16.DecodeRune(r, r2); ok && dec != utf8.RuneError {
+						r = dec
+						i += 6
+					} else {
+						r = utf8.RuneError
+					}
+				}
+
+				d.buf = utf8.AppendRune(d.buf, r)
+				i += 4
+
+			default:
+				d.pos = i
+				return "", d.errorf("invalid escape %q in string", e)
+			}
+			i += 2
+
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(data[i:])
+			d.buf = utf8.AppendRune(d.buf, r)
+			i += size
+
+		default:
+			d.buf = append(d.buf, c)
+			i++
+		}
+	}
+
+	d.pos = len(data)
+	return "", d.errorf("unexpected end of string")
+}
+
+func hex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+
+	r := rune(0)
+	for _, c := range b[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+
+	return r, true
+}
+
+func toString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+// skip validates and skips any value
+func (d *decoder) skip(depth int) error {
+	if depth > maxDepth {
+		return d.errorf("exceeded max depth")
+	}
+	if d.pos == len(d.data) {
+		return d.errorf("unexpected end of input")
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == '"':
+		start := len(d.buf)
+		_, err := d.str()
+		d.buf = d.buf[:start]
+		return err
+
+	case c == '{', c == '[':
+		return d.skipList(depth)
+
+	case c == '-' || c >= '0' && c <= '9':
+		return d.number()
+
+	case d.literal("true"), d.literal("false"), d.literal("null"):
+		return nil
+	}
+
+	return d.errorf("invalid character %q looking for value", d.data[d.pos])
+}
+
+// skipList skips an object or an array
+func (d *decoder) skipList(depth int) error {
+	object := d.data[d.pos] == '{'
+	end := byte(']')
+	if object {
+		end = '}'
+	}
+	d.pos++
+
+	d.ws()
+	if d.next(end) {
+		return nil
+	}
+
+	for {
+		d.ws()
+		if object {
+			if d.pos == len(d.data) || d.data[d.pos] != '"' {
+				return d.errorf("expected object key")
+			}
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+
+			d.ws()
+			if !d.next(':') {
+				return d.errorf("expected ':' after object key")
+			}
+			d.ws()
+		}
+
+		if err := d.skip(depth + 1); err != nil {
+			return err
+		}
+
+		d.ws()
+		if d.next(end) {
+			return nil
+		}
+		if !d.next(',') {
+			return d.errorf("expected ',' or %q", end)
+		}
+	}
+}
+
+// number checks -?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?
+func (d *decoder) number() error {
+	data := d.data
+	i := d.pos
+
+	digits := func() bool {
+		start := i
+		for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+			i++
+		}
+		return i > start
+	}
+
+	if data[i] == '-' {
+		i++
+	}
+
+	switch {
+	case i < len(data) && data[i] == '0':
+		i++
+	case !digits():
+		d.pos = i
+		return d.errorf("invalid number")
+	}
+
+	if i < len(data) && data[i] == '.' {
+		i++
+		if !digits() {
+			d.pos = i
+			return d.errorf("invalid number")
+		}
+	}
+
+	if i < len(data) && (data[i] == 'e' || data[i] == 'E') {
+		i++
+		if i < len(data) && (data[i] == '+' || data[i] == '-') {
+			i++
+		}
+		if !digits() {
+			d.pos = i
+			return d.errorf("invalid number")
+		}
+	}
+
+	d.pos = i
+	return nil
+}
+
+func (d *decoder) literal(s string) bool {
+	if !bytes.HasPrefix(d.data[d.pos:], []byte(s)) {
+		return false
+	}
+	d.pos += len(s)
+	return true
+}
+
+func (d *decoder) null() bool {
+	return d.literal("null")
+}
+
+func (d *decoder) next(c byte) bool {
+	if d.pos < len(d.data) && d.data[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *decoder) ws() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *decoder) end() error {
+	d.ws()
+	if d.pos != len(d.data) {
+		return d.errorf("invalid character %q after top-level value", d.data[d.pos])
+	}
+	return nil
+}
+
+// skipTypeError skips the value of a wrong type, a syntax error in it wins
+// like in encoding/json
+func (d *decoder) skipTypeError() error {
+	if err := d.skip(0); err != nil {
+		return err
+	}
+	return d.errorf("cannot unmarshal non string into string")
+}
+
+func (d *decoder) typeError(field string) error {
+	if err := d.skip(0); err != nil {
+		return err
+	}
+	return d.errorf("cannot unmarshal %s", field)
+}
+
+// SyntaxError is a decoding error at Offset bytes into the line
+type SyntaxError struct {
+	Msg    string
+	Offset int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("json: %s at offset %d", e.Msg, e.Offset)
+}
+
+func (d *decoder) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{fmt.Sprintf(format, args...), d.pos}
+}
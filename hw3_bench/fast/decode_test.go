@@ -0,0 +1,189 @@
+package fast
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		exp   User
+	}{
+		{"plain", `{"browsers":["a","b"],"name":"Bob","email":"bob@mail.ru","job":"x"}`,
+			User{Browsers: []string{"a", "b"}, Name: "Bob", Email: "bob@mail.ru", Job: "x"}},
+		{"escapes", `{"name":"a\"b\\c\/d\b\f\n\r\t","email":"\u0041\u00e9\u4e16"}`,
+			User{Name: "a\"b\\c/d\b\f\n\r\t", Email: "Aé世"}},
+		{"surrogates", `{"name":"\ud83d\ude00","email":"\ud83dx","job":"\ude00\u0041"}`,
+			User{Name: "😀", Email: "\ufffdx", Job: "\ufffdA"}},
+		{"invalid utf8", "{\"name\":\"a\xffb\",\"email\":\"é\"}",
+			User{Name: "a\ufffdb", Email: "é"}},
+		{"nulls", `{"browsers":null,"name":null,"email":"e"}`,
+			User{Email: "e"}},
+		{"null element", `{"browsers":["a",null]}`,
+			User{Browsers: []string{"a", ""}}},
+		{"fold keys", `{"NAME":"n","Email":"e","browſers":["b"]}`,
+			User{Browsers: []string{"b"}, Name: "n", Email: "e"}},
+		{"duplicate keys", `{"name":"a","name":"b"}`,
+			User{Name: "b"}},
+		{"unknown", ` { "age" : [1, -2.5e+3, {"a": [true, false, null]}, "\u0000"], "name" : "n" } `,
+			User{Name: "n"}},
+		{"top null", `null`, User{}},
+		{"empty", `{}`, User{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := User{}
+			if err := newDecoder(allFields).decode([]byte(test.input), &u); err != nil {
+				t.Fatal(err)
+			}
+
+			if !equalUsers(&u, &test.exp) {
+				t.Errorf("exp %+v, got %+v", test.exp, u)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`{`,
+		`{"name"}`,
+		`{"name":"a"`,
+		`{"name":"a",}`,
+		`{"name":"a"} x`,
+		`{"name":1}`,
+		`{"name":"a\x"}`,
+		`{"name":"a\u12"}`,
+		"{\"name\":\"a\nb\"}",
+		`{"browsers":"a"}`,
+		`{"browsers":["a",1]}`,
+		`{"browsers":["a",]}`,
+		`{"age":01}`,
+		`{"age":1.}`,
+		`{"age":-}`,
+		`{"age":1e}`,
+		`{"age":tru}`,
+		`{"age":[1 2]}`,
+		`{"age":{"a" 1}}`,
+		`{"age":{1:1}}`,
+		`[]`,
+		`"user"`,
+	}
+
+	for _, input := range tests {
+		u := User{}
+		if err := newDecoder(allFields).decode([]byte(input), &u); err == nil {
+			t.Errorf("%s: exp error", input)
+		}
+	}
+}
+
+func TestDecodeMask(t *testing.T) {
+	u := User{}
+	input := `{"browsers":["a"],"company":1,"name":"n","email":"e","job":"j"}`
+
+	if err := newDecoder(mask(DefaultFilter)).decode([]byte(input), &u); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := User{Browsers: []string{"a"}, Name: "n", Email: "e"}
+	if !equalUsers(&u, &exp) {
+		t.Errorf("exp %+v, got %+v", exp, u)
+	}
+}
+
+func TestDecodeAllocs(t *testing.T) {
+	lines := userLines(t)
+	d := newDecoder(allFields)
+	u := User{}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		for _, l := range lines {
+			u = User{Browsers: u.Browsers[:0]}
+			if err := d.decode(l, &u); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	if allocs != 0 {
+		t.Fatalf("exp no allocations, got %v", allocs)
+	}
+}
+
+// FuzzDecode checks the decoder against encoding/json
+func FuzzDecode(f *testing.F) {
+	for _, l := range userLines(f)[:20] {
+		f.Add(l)
+	}
+	f.Add([]byte(`{"browsers":["a",null],"Browsers":[null,"b"],"NAME":"\ud83d\ude00\ud83d"}`))
+	f.Add([]byte(`{"age":[1,-2.5e+3,{"a":[true,false,null]}],"job":"\u0000\t"}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// plainUser has no UnmarshalJSON method of easyjson
+		type plainUser User
+
+		exp := User{}
+		expErr := json.Unmarshal(data, (*plainUser)(&exp))
+
+		got := User{}
+		gotErr := newDecoder(allFields).decode(data, &got)
+
+		if (expErr == nil) != (gotErr == nil) {
+			t.Fatalf("%q: exp error %v, got %v", data, expErr, gotErr)
+		}
+		if expErr == nil && !equalUsers(&got, &exp) {
+			t.Fatalf("%q:\nexp %+v\ngot %+v", data, exp, got)
+		}
+	})
+}
+
+func equalUsers(a, b *User) bool {
+	return slices.Equal(a.Browsers, b.Browsers) &&
+		a.Company == b.Company && a.Country == b.Country && a.Email == b.Email &&
+		a.Job == b.Job && a.Name == b.Name && a.Phone == b.Phone
+}
+
+func userLines(tb testing.TB) [][]byte {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return bytes.Split(data, []byte("\n"))
+}
+
+func BenchmarkDecode(b *testing.B) {
+	lines := userLines(b)
+	d := newDecoder(mask(DefaultFilter))
+	u := User{}
+
+	for i := 0; i < b.N; i++ {
+		for _, l := range lines {
+			u = User{Browsers: u.Browsers[:0]}
+			if err := d.decode(l, &u); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecodeEasyJson(b *testing.B) {
+	lines := userLines(b)
+	u := User{}
+
+	for i := 0; i < b.N; i++ {
+		for _, l := range lines {
+			u = User{Browsers: u.Browsers[:0]}
+			if err := u.UnmarshalJSON(l); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
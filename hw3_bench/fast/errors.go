@@ -0,0 +1,74 @@
+package fast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mailru/easyjson/jlexer"
+)
+
+var ErrTooManyErrors = errors.New("too many bad lines")
+
+// LineError is a line of the input that failed to decode, Offset is the byte
+// offset of the error from the start of the input
+type LineError struct {
+	Line   int
+	Offset int64
+	Err    error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d, offset %d: %v", e.Line, e.Offset, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// lineError adds the offset in the line of the errors of the decoder,
+// encoding/json and easyjson
+func lineError(line int, start int64, err error) *LineError {
+	offset := start
+	var (
+		serr *SyntaxError
+		jerr *json.SyntaxError
+		terr *json.UnmarshalTypeError
+		lerr *jlexer.LexerError
+	)
+	switch {
+	case errors.As(err, &serr):
+		offset += int64(serr.Offset)
+	case errors.As(err, &jerr):
+		offset += jerr.Offset
+	case errors.As(err, &terr):
+		offset += terr.Offset
+	case errors.As(err, &lerr):
+		offset += int64(lerr.Offset)
+	}
+	return &LineError{line, offset, err}
+}
+
+// badLines counts the lines skipped in the lenient mode
+type badLines struct {
+	s *Searcher
+	n int
+}
+
+// add returns err back unless the searcher is lenient and there were no
+// more than MaxErrors bad lines so far
+func (b *badLines) add(err *LineError) error {
+	if !b.s.Lenient {
+		return err
+	}
+
+	b.n++
+	if b.s.MaxErrors > 0 && b.n > b.s.MaxErrors {
+		return fmt.Errorf("%w: %w", ErrTooManyErrors, err)
+	}
+
+	if b.s.OnError != nil {
+		b.s.OnError(err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package fast
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func badInput(t *testing.T) (input, fixed string) {
+	lines := userLines(t)[:40]
+
+	good := make([]string, len(lines))
+	for i, l := range lines {
+		good[i] = string(l)
+	}
+	bad := append([]string(nil), good...)
+
+	bad[3] = `{"browsers":["MSIE"],"name":"x"`
+	bad[10] = `not json`
+	bad[11] = ``
+	bad[25] = `{"name":1,"email":"e"}`
+
+	fixed = strings.Join(good, "\n")
+	for _, i := range []int{3, 10, 11, 25} {
+		fixed = strings.Replace(fixed, good[i], "{}", 1)
+	}
+
+	return strings.Join(bad, "\n") + "\n", fixed + "\n"
+}
+
+func TestSearchLenient(t *testing.T) {
+	input, fixed := badInput(t)
+
+	exp := new(bytes.Buffer)
+	if err := Search(strings.NewReader(fixed), exp); err != nil {
+		t.Fatal(err)
+	}
+
+	// errors are at the end of line 3, at the start of 10 and 11 and after
+	// the number in 25
+	expLines := []int{3, 10, 11, 25}
+	inLine := []int{len(`{"browsers":["MSIE"],"name":"x"`), 0, 0, len(`{"name":1`)}
+	expOffsets := []int64{}
+	for i, n := range expLines {
+		off := inLine[i]
+		for _, l := range strings.Split(input, "\n")[:n] {
+			off += len(l) + 1
+		}
+		expOffsets = append(expOffsets, int64(off))
+	}
+
+	defer func(size int) { chunkSize = size }(chunkSize)
+	chunkSize = 100
+
+	searches := map[string]func(s *Searcher, w *bytes.Buffer) error{
+		"sequential": func(s *Searcher, w *bytes.Buffer) error { return s.Search(strings.NewReader(input), w) },
+		"parallel":   func(s *Searcher, w *bytes.Buffer) error { return s.SearchParallel(strings.NewReader(input), w, 3) },
+	}
+
+	for name, search := range searches {
+		t.Run(name, func(t *testing.T) {
+			err := search(&Searcher{}, new(bytes.Buffer))
+
+			lerr := &LineError{}
+			if !errors.As(err, &lerr) || lerr.Line != 3 {
+				t.Fatalf("exp error at line 3, got %v", err)
+			}
+
+			bad := []*LineError{}
+			got := new(bytes.Buffer)
+			s := &Searcher{Lenient: true, OnError: func(err *LineError) { bad = append(bad, err) }}
+			if err := search(s, got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.String() != exp.String() {
+				t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, exp)
+			}
+
+			if len(bad) != len(expLines) {
+				t.Fatalf("exp %d bad lines, got %v", len(expLines), bad)
+			}
+			for i, e := range bad {
+				if e.Line != expLines[i] || e.Offset != expOffsets[i] {
+					t.Errorf("exp line %d at %d, got %v", expLines[i], expOffsets[i], e)
+				}
+			}
+
+			err = search(&Searcher{Lenient: true, MaxErrors: 3}, new(bytes.Buffer))
+			if !errors.Is(err, ErrTooManyErrors) || !errors.As(err, &lerr) || lerr.Line != 25 {
+				t.Fatalf("exp too many errors at line 25, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSplitSearchErrors(t *testing.T) {
+	input, fixed := badInput(t)
+
+	searches := map[string]func(s *Searcher, w io.Writer, data []byte) error{
+		"Default":  (*Searcher).Default,
+		"EasyJson": (*Searcher).EasyJson,
+	}
+
+	for name, search := range map[string]func(w *bytes.Buffer, data []byte) error{
+		"Default":  func(w *bytes.Buffer, data []byte) error { return Default(w, data) },
+		"EasyJson": func(w *bytes.Buffer, data []byte) error { return EasyJson(w, data) },
+	} {
+		lenient := searches[name]
+		t.Run(name, func(t *testing.T) {
+			exp := new(bytes.Buffer)
+			if err := Search(strings.NewReader(fixed), exp); err != nil {
+				t.Fatal(err)
+			}
+
+			got := new(bytes.Buffer)
+			if err := search(got, []byte(fixed)); err != nil {
+				t.Fatalf("trailing newline: %v", err)
+			}
+			if got.String() != exp.String() {
+				t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, exp)
+			}
+
+			err := search(new(bytes.Buffer), []byte(input))
+			if err == nil || !strings.HasPrefix(err.Error(), "line 3,") {
+				t.Errorf("exp error at line 3, got %v", err)
+			}
+
+			bad := []*LineError{}
+			got.Reset()
+			s := &Searcher{Lenient: true, OnError: func(err *LineError) { bad = append(bad, err) }}
+			if err := lenient(s, got, []byte(input)); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != exp.String() {
+				t.Errorf("lenient results not match\nGot:\n%v\nExpected:\n%v", got, exp)
+			}
+
+			// the decoders stop at different places, the offset is in the line
+			// and past the number in line 25
+			lines := strings.SplitAfter(input, "\n")
+			expLines := []int{3, 10, 11, 25}
+			if len(bad) != len(expLines) {
+				t.Fatalf("exp %d bad lines, got %v", len(expLines), bad)
+			}
+			for i, e := range bad {
+				start := int64(len(strings.Join(lines[:expLines[i]], "")))
+				if e.Line != expLines[i] || e.Offset < start || e.Offset >= start+int64(len(lines[e.Line])) {
+					t.Errorf("exp line %d at %d, got %v", expLines[i], start, e)
+				}
+				if e.Line == 25 && e.Offset != start+int64(len(`{"name":1`)) {
+					t.Errorf("exp offset after the number, got %v", e)
+				}
+			}
+
+			err = lenient(&Searcher{Lenient: true, MaxErrors: 3}, new(bytes.Buffer), []byte(input))
+			if !errors.Is(err, ErrTooManyErrors) {
+				t.Errorf("exp too many errors, got %v", err)
+			}
+		})
+	}
+}
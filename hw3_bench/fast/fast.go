@@ -19,72 +19,48 @@ type User struct {
 	Phone    string   `json:"phone,nocopy,omitempty"`
 }
 
-func EasyJson(w io.Writer, data []byte) {
-	seen := map[string]bool{}
-	user := User{}
-
-	fmt.Fprintln(w, "found users:")
-
-	for i, l := range bytes.Split(data, []byte("\n")) {
-		err := user.UnmarshalJSON(l)
-		if err != nil {
-			panic(err)
-		}
-
-		android := false
-		msie := false
-
-		for _, browser := range user.Browsers {
-			if strings.Contains(browser, "Android") {
-				android = true
-			} else if strings.Contains(browser, "MSIE") {
-				msie = true
-			} else {
-				continue
-			}
-
-			seen[browser] = true
-		}
+// EasyJson and Default search the whole input read into data, decoding the
+// lines with easyjson and encoding/json
+func EasyJson(w io.Writer, data []byte) error {
+	return (&Searcher{}).EasyJson(w, data)
+}
 
-		if !(android && msie) {
-			continue
-		}
+func Default(w io.Writer, data []byte) error {
+	return (&Searcher{}).Default(w, data)
+}
 
-		mail := strings.Replace(user.Email, "@", " [at] ", 1)
-		fmt.Fprintf(w, "[%d] %s <%s>\n", i, user.Name, mail)
-	}
+// EasyJson and Default use Filter and handle bad lines as Search does, the
+// output is always text
+func (s *Searcher) EasyJson(w io.Writer, data []byte) error {
+	return s.split(w, data, func(l []byte, u *User) error { return u.UnmarshalJSON(l) })
+}
 
-	fmt.Fprintln(w, "\nTotal unique browsers", len(seen))
+func (s *Searcher) Default(w io.Writer, data []byte) error {
+	return s.split(w, data, func(l []byte, u *User) error { return json.Unmarshal(l, u) })
 }
 
-func Default(w io.Writer, data []byte) {
+func (s *Searcher) split(w io.Writer, data []byte, unmarshal func(l []byte, u *User) error) error {
+	filter := s.filter()
+	bad := badLines{s: s}
 	seen := map[string]bool{}
 	user := User{}
 
 	fmt.Fprintln(w, "found users:")
 
-	for i, l := range bytes.Split(data, []byte("\n")) {
-		err := json.Unmarshal(l, &user)
+	start := int64(0)
+	for i, l := range splitLines(data) {
+		user = User{}
+		err := unmarshal(l, &user)
+		lstart := start
+		start += int64(len(l) + 1)
 		if err != nil {
-			panic(err)
-		}
-
-		android := false
-		msie := false
-
-		for _, browser := range user.Browsers {
-			if strings.Contains(browser, "Android") {
-				android = true
-			} else if strings.Contains(browser, "MSIE") {
-				msie = true
-			} else {
-				continue
+			if err := bad.add(lineError(i, lstart, err)); err != nil {
+				return err
 			}
-
-			seen[browser] = true
+			continue
 		}
 
-		if !(android && msie) {
+		if !filter.Match(&user, seen) {
 			continue
 		}
 
@@ -92,5 +68,14 @@ func Default(w io.Writer, data []byte) {
 		fmt.Fprintf(w, "[%d] %s <%s>\n", i, user.Name, mail)
 	}
 
-	fmt.Fprintln(w, "\nTotal unique browsers", len(seen))
+	_, err := fmt.Fprintln(w, "\nTotal unique browsers", len(seen))
+	return err
+}
+
+// splitLines does not return an empty line after the trailing newline
+func splitLines(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+	return bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
 }
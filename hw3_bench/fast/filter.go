@@ -0,0 +1,598 @@
+package fast
+
+import (
+	"coursera-go/hw3_bench/aho"
+	"coursera-go/hw3_bench/ua"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Filter is a compiled expression over User fields, e.g.
+//
+//	browser~"Android" && browser~"MSIE" && country=="Kenya"
+//
+// Fields are browser, name, email, company, country, job and phone, operators
+// are == != ~ (contains) !~ && || ! and parentheses. browser== and browser~
+// are true when any of the user browsers satisfies them, != and !~ negate
+// that. Browsers matching any of the browser conditions are counted as seen.
+//
+// The parsed user agent is available as ua.family, ua.os, ua.device and
+// ua.version, ua.osversion which also support < <= > >= against versions
+// like 9 or 10.6. any(...) requires a single browser to satisfy all of the
+// conditions inside, so IE older than 9 on Windows is
+//
+//	any(ua.family=="IE" && ua.version<9 && ua.os=="Windows")
+type Filter struct {
+	expr     string
+	root     *node
+	browsers []browserCond
+	parse    bool
+	fields   uint
+
+	// browser~ conditions are matched all at once by the automaton when there
+	// are enough of them, pattern i is condition conds[i]
+	matcher *aho.Matcher
+	conds   []uint64
+	matched uint64
+}
+
+var DefaultFilter = MustCompile(`browser~"Android" && browser~"MSIE"`)
+
+const maxBrowserConds = 64
+
+// minPatterns is the number of browser~ conditions from which the automaton
+// beats strings.Contains for each of them, see BenchmarkFilterPatterns
+var minPatterns = 8
+
+// browserCond is evaluated for every browser of the user, key is used to
+// share the same condition between several places of the expression
+type browserCond struct {
+	key string
+	n   *node
+}
+
+func Compile(expr string) (*Filter, error) {
+	p := parser{src: expr, f: &Filter{expr: expr}}
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+
+	p.f.root = root
+	p.f.compilePatterns()
+	return p.f, nil
+}
+
+func (f *Filter) compilePatterns() {
+	patterns := []string{}
+	conds := []uint64{}
+	for i, c := range f.browsers {
+		if c.n.kind == nodeField && c.n.field == fieldBrowser && c.n.op == "~" {
+			patterns = append(patterns, c.n.value)
+			conds = append(conds, 1<<i)
+		}
+	}
+
+	if len(patterns) < minPatterns {
+		return
+	}
+
+	f.matcher = aho.New(patterns)
+	f.conds = conds
+	for _, c := range conds {
+		f.matched |= c
+	}
+}
+
+func MustCompile(expr string) *Filter {
+	f, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match evaluates the filter and adds the browsers matching the browser
+// conditions to seen, if seen is not nil. User strings may point into a reused
+// buffer, so they are copied before going into the map
+func (f *Filter) Match(u *User, seen map[string]bool) bool {
+	e := env{u: u}
+
+	for _, b := range u.Browsers {
+		e.browser = b
+		if f.parse {
+			e.ua = ua.Parse(b)
+		}
+
+		hit := false
+		if f.matcher != nil {
+			for h := f.matcher.Match64(b); h != 0; h &= h - 1 {
+				e.hits |= f.conds[bits.TrailingZeros64(h)]
+				hit = true
+			}
+		}
+
+		for i, c := range f.browsers {
+			if f.matched&(1<<i) == 0 && c.n.eval(&e) {
+				e.hits |= 1 << i
+				hit = true
+			}
+		}
+
+		if hit && seen != nil && !seen[b] {
+			seen[strings.Clone(b)] = true
+		}
+	}
+
+	return f.root.eval(&e)
+}
+
+// env is the user being matched, browser conditions see the current browser
+// and the top level sees which browser conditions were hit
+type env struct {
+	u       *User
+	hits    uint64
+	browser string
+	ua      ua.UA
+}
+
+const (
+	nodeAnd = iota
+	nodeOr
+	nodeNot
+	nodeBrowser
+	nodeField
+	nodeVersion
+)
+
+// node is a single struct rather than an interface, so that env does not
+// escape and Match does not allocate
+type node struct {
+	kind int
+	l, r *node
+
+	bit     uint64
+	field   int
+	op      string
+	value   string
+	pattern ua.Pattern
+}
+
+func (n *node) eval(e *env) bool {
+	switch n.kind {
+	case nodeAnd:
+		return n.l.eval(e) && n.r.eval(e)
+	case nodeOr:
+		return n.l.eval(e) || n.r.eval(e)
+	case nodeNot:
+		return !n.l.eval(e)
+	case nodeBrowser:
+		return e.hits&n.bit != 0
+	case nodeField:
+		return n.matchField(e)
+	case nodeVersion:
+		return n.matchVersion(e)
+	}
+	return false
+}
+
+const (
+	fieldName = iota
+	fieldEmail
+	fieldCompany
+	fieldCountry
+	fieldJob
+	fieldPhone
+
+	// per browser
+	fieldBrowser
+	fieldFamily
+	fieldOS
+	fieldDevice
+	fieldVersion
+	fieldOSVersion
+)
+
+var fields = map[string]int{
+	"name":    fieldName,
+	"email":   fieldEmail,
+	"company": fieldCompany,
+	"country": fieldCountry,
+	"job":     fieldJob,
+	"phone":   fieldPhone,
+
+	"browser":      fieldBrowser,
+	"ua.family":    fieldFamily,
+	"ua.os":        fieldOS,
+	"ua.device":    fieldDevice,
+	"ua.version":   fieldVersion,
+	"ua.osversion": fieldOSVersion,
+}
+
+func (e *env) field(f int) string {
+	switch f {
+	case fieldBrowser:
+		return e.browser
+	case fieldFamily:
+		return e.ua.Family
+	case fieldOS:
+		return e.ua.OS
+	case fieldDevice:
+		return e.ua.Device
+	}
+	return e.u.field(f)
+}
+
+func (u *User) field(f int) string {
+	switch f {
+	case fieldName:
+		return u.Name
+	case fieldEmail:
+		return u.Email
+	case fieldCompany:
+		return u.Company
+	case fieldCountry:
+		return u.Country
+	case fieldJob:
+		return u.Job
+	case fieldPhone:
+		return u.Phone
+	}
+	return ""
+}
+
+func (n *node) matchField(e *env) bool {
+	v := e.field(n.field)
+
+	switch n.op {
+	case "==":
+		return v == n.value
+	case "!=":
+		return v != n.value
+	case "~":
+		return strings.Contains(v, n.value)
+	case "!~":
+		return !strings.Contains(v, n.value)
+	}
+	return false
+}
+
+func (n *node) matchVersion(e *env) bool {
+	v := e.ua.Version
+	if n.field == fieldOSVersion {
+		v = e.ua.OSVersion
+	}
+
+	c := n.pattern.Compare(v)
+
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+// longer operators go first
+var ops = []string{"&&", "||", "==", "!=", "!~", "<=", ">=", "~", "!", "<", ">", "(", ")"}
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+	f   *Filter
+	any bool
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("filter: %s at %d", fmt.Sprintf(format, args...), p.tok.pos)
+}
+
+func (p *parser) scan() error {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = token{tokEOF, "", start}
+		return nil
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '"':
+		end := p.pos + 1
+		for end < len(p.src) && p.src[end] != '"' {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			p.tok.pos = start
+			return p.errorf("unterminated string")
+		}
+
+		s, err := strconv.Unquote(p.src[start : end+1])
+		if err != nil {
+			p.tok.pos = start
+			return p.errorf("bad string %s", p.src[start:end+1])
+		}
+
+		p.pos = end + 1
+		p.tok = token{tokString, s, start}
+
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '.':
+		for p.pos < len(p.src) && isIdent(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok = token{tokIdent, p.src[start:p.pos], start}
+
+	case c >= '0' && c <= '9':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = token{tokNumber, p.src[start:p.pos], start}
+
+	default:
+		for _, op := range ops {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				p.tok = token{tokOp, op, start}
+				return nil
+			}
+		}
+
+		p.tok.pos = start
+		return p.errorf("unexpected %q", c)
+	}
+
+	return nil
+}
+
+func isIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.'
+}
+
+func (p *parser) is(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) or() (*node, error) {
+	l, err := p.and()
+	for err == nil && p.is("||") {
+		if err = p.scan(); err != nil {
+			break
+		}
+
+		var r *node
+		if r, err = p.and(); err == nil {
+			l = &node{kind: nodeOr, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) and() (*node, error) {
+	l, err := p.unary()
+	for err == nil && p.is("&&") {
+		if err = p.scan(); err != nil {
+			break
+		}
+
+		var r *node
+		if r, err = p.unary(); err == nil {
+			l = &node{kind: nodeAnd, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) unary() (*node, error) {
+	switch {
+	case p.is("!"):
+		if err := p.scan(); err != nil {
+			return nil, err
+		}
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &node{kind: nodeNot, l: x}, nil
+
+	case p.is("("):
+		if err := p.scan(); err != nil {
+			return nil, err
+		}
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(")") {
+			return nil, p.errorf("expected )")
+		}
+		return x, p.scan()
+
+	case p.tok.kind == tokIdent && p.tok.text == "any":
+		return p.anyBrowser()
+	}
+
+	return p.cond()
+}
+
+// anyBrowser parses any(...) into a single browser condition
+func (p *parser) anyBrowser() (*node, error) {
+	if p.any {
+		return nil, p.errorf("nested any")
+	}
+
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	if !p.is("(") {
+		return nil, p.errorf("expected ( after any")
+	}
+	start := p.tok.pos
+
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+
+	p.any = true
+	x, err := p.or()
+	p.any = false
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.is(")") {
+		return nil, p.errorf("expected )")
+	}
+	key := "any" + p.src[start:p.tok.pos+1]
+
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+
+	return p.browser(key, x)
+}
+
+func (p *parser) cond() (*node, error) {
+	if p.tok.kind != tokIdent {
+		return nil, p.errorf("expected field, got %q", p.tok.text)
+	}
+	name := p.tok.text
+
+	field, ok := fields[name]
+	if !ok {
+		return nil, p.errorf("unknown field %s", name)
+	}
+	if p.any && field < fieldBrowser {
+		return nil, p.errorf("%s is not a browser field", name)
+	}
+
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	op := p.tok.text
+	if p.tok.kind != tokOp || !isComparison(op) {
+		return nil, p.errorf("expected comparison after %s", name)
+	}
+	pos := p.tok.pos
+
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokString && p.tok.kind != tokNumber {
+		return nil, p.errorf("expected value after %s", op)
+	}
+	value := p.tok.text
+
+	if err := p.scan(); err != nil {
+		return nil, err
+	}
+
+	n := &node{kind: nodeField, field: field, op: op, value: value}
+	switch field {
+	case fieldVersion, fieldOSVersion:
+		pattern, ok := ua.ParsePattern(value)
+		if !ok || op == "~" || op == "!~" {
+			return nil, fmt.Errorf("filter: bad version comparison %s%s%q at %d", name, op, value, pos)
+		}
+		n.kind = nodeVersion
+		n.pattern = pattern
+
+	default:
+		if op != "==" && op != "!=" && op != "~" && op != "!~" {
+			return nil, fmt.Errorf("filter: %s can not be compared with %s at %d", name, op, pos)
+		}
+	}
+
+	if field >= fieldFamily {
+		p.f.parse = true
+	}
+	p.f.fields |= 1 << min(field, fieldBrowser)
+	if field < fieldBrowser || p.any {
+		return n, nil
+	}
+
+	// on the top level browser!="x" means that none of the browsers is "x"
+	neg := op == "!=" || op == "!~"
+	if neg {
+		n.op = strings.TrimPrefix(op, "!")
+		if n.op == "=" {
+			n.op = "=="
+		}
+	}
+
+	x, err := p.browser(fmt.Sprintf("%d%s%q", field, n.op, value), n)
+	if neg && err == nil {
+		x = &node{kind: nodeNot, l: x}
+	}
+
+	return x, err
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "~", "!~", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+func (p *parser) browser(key string, n *node) (*node, error) {
+	bit := -1
+	for i, c := range p.f.browsers {
+		if c.key == key {
+			bit = i
+		}
+	}
+
+	if bit < 0 {
+		if len(p.f.browsers) == maxBrowserConds {
+			return nil, fmt.Errorf("filter: more than %d browser conditions", maxBrowserConds)
+		}
+		bit = len(p.f.browsers)
+		p.f.browsers = append(p.f.browsers, browserCond{key, n})
+	}
+
+	return &node{kind: nodeBrowser, bit: 1 << bit}, nil
+}
@@ -0,0 +1,241 @@
+package fast
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var filterUser = User{
+	Browsers: []string{
+		"Mozilla/5.0 (Linux; U; Android 2.3.4; fr-fr) AppleWebKit/533.1",
+		"Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 5.1)",
+		"Opera/9.80 (X11; Linux x86_64; U; en) Presto/2.2.15 Version/10.10",
+	},
+	Company: "Flashpoint",
+	Country: "Kenya",
+	Email:   "user@example.org",
+	Name:    "Sharon Crawford",
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		expr  string
+		match bool
+		seen  []string
+	}{
+		{`browser~"Android" && browser~"MSIE"`, true, []string{"Android", "MSIE"}},
+		{`browser~"Android" && browser~"MSIE" && country=="Kenya"`, true, []string{"Android", "MSIE"}},
+		{`browser~"Android" && country!="Kenya"`, false, []string{"Android"}},
+		{`browser~"Chrome" || (company~"flash" || company~"Flash")`, true, []string{}},
+		{`!browser~"Chrome" && browser!~"Safari"`, true, []string{}},
+		{`browser=="Opera/9.80 (X11; Linux x86_64; U; en) Presto/2.2.15 Version/10.10"`, true, []string{"Opera"}},
+		{`name=="Sharon Crawford" && email~"@example"`, true, []string{}},
+		{`browser~"Linux"`, true, []string{"Android", "Opera"}},
+		{`any(ua.family=="IE" && ua.version<9 && ua.os=="Windows")`, true, []string{"MSIE"}},
+		{`any(ua.family=="IE" && ua.os=="Linux")`, false, []string{}},
+		{`ua.family=="IE" && ua.os=="Linux"`, true, []string{"MSIE", "Opera"}},
+		{`ua.version>=10 && ua.family!="Chrome"`, true, []string{"Opera"}},
+		{`ua.osversion=="5.1" || ua.device=="Tablet"`, true, []string{"Android", "MSIE"}},
+		{`any(browser~"Android" && ua.version=="2.3")`, true, []string{"Android"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			f, err := Compile(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seen := map[string]bool{}
+			if got := f.Match(&filterUser, seen); got != test.match {
+				t.Fatalf("exp %v, got %v", test.match, got)
+			}
+
+			got := []string{}
+			for b := range seen {
+				for _, name := range []string{"Android", "MSIE", "Opera"} {
+					if strings.Contains(b, name) {
+						got = append(got, name)
+					}
+				}
+			}
+			sort.Strings(got)
+
+			if fmt.Sprint(got) != fmt.Sprint(test.seen) {
+				t.Fatalf("exp seen %v, got %v", test.seen, got)
+			}
+		})
+	}
+}
+
+func TestFilterCompileErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`browser`,
+		`browser~`,
+		`browser~Android`,
+		`browser~"Android`,
+		`browser~"Android" &&`,
+		`(browser~"Android"`,
+		`browser~"Android")`,
+		`age=="42"`,
+		`browser<"Android"`,
+		`name=="\q"`,
+		`ua.version~"9"`,
+		`ua.version<"x"`,
+		`ua.family<"IE"`,
+		`name>"A"`,
+		`any(country=="Kenya")`,
+		`any(any(browser~"x"))`,
+		`any browser~"x"`,
+		`any(browser~"x"`,
+	}
+
+	for _, expr := range tests {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("%s: exp error", expr)
+		}
+	}
+}
+
+func TestFilterAllocs(t *testing.T) {
+	f := MustCompile(`(browser~"Android" && browser~"MSIE" || browser=="x") && country!="Chad" && !name~"Bob" &&
+		any(ua.family=="IE" && ua.version<9)`)
+	seen := map[string]bool{}
+	f.Match(&filterUser, seen)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		f.Match(&filterUser, seen)
+	})
+
+	if allocs != 0 {
+		t.Fatalf("exp no allocations, got %v", allocs)
+	}
+}
+
+func TestSearchUnique(t *testing.T) {
+	input := `{"browsers":["Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0)","Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 6.1; Trident/4.0)"],"name":"A","email":"a@a"}
+{"browsers":["Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 5.1)","Opera/9.80 (Windows NT 6.1; U; en) Presto/2.7.62 Version/11.01"],"name":"B","email":"b@b"}`
+
+	tests := map[string]int{
+		"":        3,
+		"family":  1,
+		"version": 2,
+		"os":      1,
+	}
+
+	for unique, exp := range tests {
+		t.Run(unique, func(t *testing.T) {
+			s := &Searcher{Filter: MustCompile(`ua.family=="IE"`), Unique: unique}
+
+			out := new(bytes.Buffer)
+			if err := s.Search(strings.NewReader(input), out); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasSuffix(out.String(), fmt.Sprintf("Total unique browsers %d\n", exp)) {
+				t.Errorf("exp %d unique, got\n%s", exp, out)
+			}
+		})
+	}
+
+	if err := (&Searcher{Unique: "planet"}).Search(strings.NewReader(input), io.Discard); err == nil {
+		t.Error("exp error for unknown unique key")
+	}
+}
+
+// browser tokens of data/users.txt for the filters with many patterns
+var patterns = []string{
+	"Android", "MSIE", "Opera", "Chrome", "Safari", "Firefox", "iPad", "iPhone",
+	"Windows NT", "Linux", "Mac OS X", "Symbian", "BlackBerry", "Trident", "Gecko", "Presto",
+	"Mobile", "IEMobile", "Kindle", "Silk", "Puffin", "UCBrowser", "Konqueror", "Epiphany",
+	"SeaMonkey", "Fennec", "Opera Mini", "Nokia", "SAMSUNG", "Lumia", "Version/4.0", "en-US",
+}
+
+// manyPatterns is a filter with n browser~ conditions, every pair of them
+// joined with && and the pairs with ||
+func manyPatterns(n int) string {
+	conds := []string{}
+	for i := 0; i < n; i += 2 {
+		conds = append(conds, fmt.Sprintf(`browser~%q && browser~%q`, patterns[i], patterns[(i+1)%len(patterns)]))
+	}
+	return strings.Join(conds, " || ")
+}
+
+func TestFilterPatterns(t *testing.T) {
+	lines := userLines(t)
+	d := newDecoder(allFields)
+	u := User{}
+
+	exprs := []string{
+		manyPatterns(2),
+		manyPatterns(8),
+		manyPatterns(32),
+		manyPatterns(8) + ` || (browser=="x" && browser!~"Linux" && any(browser~"Gecko" && ua.family=="Firefox"))`,
+		`browser~"" && browser~"Android" && browser~"MSIE" && browser~"Droid" && !browser~"Opera"`,
+	}
+
+	defer func(n int) { minPatterns = n }(minPatterns)
+
+	for _, expr := range exprs {
+		minPatterns = maxBrowserConds + 1
+		contains := MustCompile(expr)
+		minPatterns = 1
+		automaton := MustCompile(expr)
+		if automaton.matcher == nil {
+			t.Fatalf("%s: expected the automaton", expr)
+		}
+
+		seen, aseen := map[string]bool{}, map[string]bool{}
+		for i, l := range lines {
+			if err := d.decode(l, &u); err != nil {
+				t.Fatal(err)
+			}
+			if contains.Match(&u, seen) != automaton.Match(&u, aseen) {
+				t.Errorf("%s: line %d does not match the same", expr, i)
+			}
+		}
+
+		if len(seen) != len(aseen) {
+			t.Errorf("%s: expected %d seen, got %d", expr, len(seen), len(aseen))
+		}
+	}
+}
+
+// go test -bench FilterPatterns -benchmem
+func BenchmarkFilterPatterns(b *testing.B) {
+	lines := userLines(b)
+	d := newDecoder(allFields)
+	// the strings point into lines, which are not reused here
+	users := make([]User, len(lines))
+	for i, l := range lines {
+		if err := d.decode(l, &users[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	defer func(n int) { minPatterns = n }(minPatterns)
+
+	for _, n := range []int{2, 4, 8, 16, 32} {
+		for _, name := range []string{"contains", "aho"} {
+			minPatterns = maxBrowserConds + 1
+			if name == "aho" {
+				minPatterns = 1
+			}
+			f := MustCompile(manyPatterns(n))
+
+			b.Run(fmt.Sprintf("%d/%s", n, name), func(b *testing.B) {
+				seen := map[string]bool{}
+				for i := 0; i < b.N; i++ {
+					for j := range users {
+						f.Match(&users[j], seen)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package fast
+
+import (
+	"bytes"
+	"context"
+	"coursera-go/hw3_bench/ua"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// followInterval is how often Follow looks at the file once it read it all
+var followInterval = 200 * time.Millisecond
+
+// Follow searches the users file at path like tail -F: the lines already in
+// it, then the complete lines appended to it, writing every found user when
+// its line is read. A truncated file is read again from the start, a file
+// replaced at path, as by log rotation, is read to its end before the new
+// one. A line without its newline at the end of a replaced file is a record
+// cut by the rotation and is dropped. Lines are numbered on across the files.
+//
+// OnSummary gets the running totals whenever they change. When ctx is done
+// the footer is written, Summary is filled and Follow returns nil
+func (s *Searcher) Follow(ctx context.Context, path string, w io.Writer) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	t := &tail{path: path}
+	if err := t.open(); err != nil {
+		return err
+	}
+	defer func() { t.f.Close() }()
+
+	filter := s.filter()
+	o := s.output()
+	d := newDecoder(mask(filter) | o.fields())
+	bad := badLines{s: s}
+	counter := newUniqueCounter(s.Unique)
+	cur := map[string]bool{}
+	user := User{}
+	out := []byte{}
+	sum := Summary{}
+
+	if err := o.header(w); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		l, err := t.next(ctx)
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		user = User{Browsers: user.Browsers[:0]}
+		if err := d.decode(l, &user); err != nil {
+			if err := bad.add(lineError(i, t.start, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		prev := sum
+		clear(cur)
+		if filter.Match(&user, cur) {
+			sum.Users++
+			out = o.appendUser(out[:0], i, &user)
+			if _, err := w.Write(out); err != nil {
+				return err
+			}
+		}
+
+		for b := range cur {
+			counter.add(b)
+		}
+		sum.Unique = counter.count()
+		if sum != prev && s.OnSummary != nil {
+			s.OnSummary(sum)
+		}
+	}
+
+	return s.footer(o, w, sum.Users, counter.seen)
+}
+
+// uniqueCounter counts the seen browsers as unique does, while they come
+type uniqueCounter struct {
+	key  func(a ua.UA) string
+	seen map[string]bool
+	keys map[string]bool
+}
+
+func newUniqueCounter(unique string) *uniqueCounter {
+	return &uniqueCounter{key: uniqueKeys[unique], seen: map[string]bool{}, keys: map[string]bool{}}
+}
+
+func (c *uniqueCounter) add(b string) {
+	if c.seen[b] {
+		return
+	}
+	// b is in the line, which is reused
+	b = strings.Clone(b)
+	c.seen[b] = true
+	if c.key != nil {
+		c.keys[c.key(ua.Parse(b))] = true
+	}
+}
+
+func (c *uniqueCounter) count() int {
+	if c.key != nil {
+		return len(c.keys)
+	}
+	return len(c.seen)
+}
+
+// tail reads the complete lines of the file at path as they are appended.
+// buf has the data read from f, from pos in it, off is the start of what was
+// not returned yet
+type tail struct {
+	path string
+	f    *os.File
+	buf  []byte
+	off  int
+	pos  int64
+	// start is the offset of the last line in its file
+	start int64
+}
+
+func (t *tail) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	n, _ := f.ReadAt(head, 0)
+	if compressed(head[:n]) {
+		f.Close()
+		return fmt.Errorf("follow: %s is compressed", t.path)
+	}
+
+	t.f = f
+	t.buf, t.off, t.pos = t.buf[:0], 0, 0
+	return nil
+}
+
+// next returns the next line, valid until the next call. It waits for the
+// line to be completed, an error means that ctx is done or reading failed
+func (t *tail) next(ctx context.Context) ([]byte, error) {
+	for {
+		if i := bytes.IndexByte(t.buf[t.off:], '\n'); i >= 0 {
+			l := t.buf[t.off : t.off+i]
+			t.start = t.pos + int64(t.off)
+			t.off += i + 1
+			return l, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// the returned lines are not needed any more
+		n := copy(t.buf, t.buf[t.off:])
+		t.buf = t.buf[:n]
+		t.pos += int64(t.off)
+		t.off = 0
+
+		if len(t.buf) == cap(t.buf) {
+			t.buf = slices.Grow(t.buf, readerSize)
+		}
+		n, err := t.f.Read(t.buf[len(t.buf):cap(t.buf)])
+		t.buf = t.buf[:len(t.buf)+n]
+		if n > 0 {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		l, err := t.end(ctx)
+		if l != nil || err != nil {
+			return l, err
+		}
+	}
+}
+
+// end is called when all of f was read. It switches to the new file at path
+// or reads f again after it was truncated, otherwise waits. The part of a
+// line left in a replaced file is dropped
+func (t *tail) end(ctx context.Context) ([]byte, error) {
+	cur, err := t.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(t.path)
+	switch {
+	case os.IsNotExist(err):
+		// moved away, the new file is not there yet
+	case err != nil:
+		return nil, err
+
+	case !os.SameFile(fi, cur):
+		// f could be written after the last read and before it was replaced,
+		// that is read first
+		cur, err := t.f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if cur.Size() > t.pos+int64(len(t.buf)) {
+			return nil, nil
+		}
+		t.f.Close()
+		return nil, t.open()
+
+	case cur.Size() < t.pos+int64(len(t.buf)):
+		// the part of a line before the truncation is dropped
+		if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		t.buf, t.off, t.pos = t.buf[:0], 0, 0
+		return nil, nil
+	}
+
+	timer := time.NewTimer(followInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, nil
+	}
+}
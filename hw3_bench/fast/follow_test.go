@@ -0,0 +1,192 @@
+package fast
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is written by Follow and read by the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	defer func(d time.Duration) { followInterval = d }(followInterval)
+	followInterval = time.Millisecond
+
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data)+"\n", "\n")
+
+	// line 750 is cut by the rotation and never read
+	read := append(lines[:750:750], lines[751:]...)
+
+	// every user is found, so the test sees every line read
+	all := MustCompile(`browser~""`)
+
+	for _, unique := range []string{"", "family"} {
+		t.Run("unique="+unique, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "users.txt")
+			appendFile(t, path, strings.Join(lines[:300], ""))
+
+			// the output of Search over the lines read so far, the footer only
+			// at the end
+			expected := func(n int, footer bool) string {
+				out := new(bytes.Buffer)
+				s := &Searcher{Filter: all, Unique: unique}
+				if err := s.Search(strings.NewReader(strings.Join(read[:n], "")), out); err != nil {
+					t.Fatal(err)
+				}
+				if footer {
+					return out.String()
+				}
+				return out.String()[:strings.LastIndex(out.String(), "\n\nTotal")+1]
+			}
+
+			out := &syncBuffer{}
+			wait := func(n int) {
+				exp := expected(n, false)
+				for deadline := time.Now().Add(5 * time.Second); out.String() != exp; time.Sleep(time.Millisecond) {
+					if time.Now().After(deadline) {
+						t.Fatalf("after %d lines got:\n%s\nexpected:\n%s", n, out, exp)
+					}
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			sum, last := Summary{}, Summary{}
+			s := &Searcher{Filter: all, Unique: unique, Summary: &sum, OnSummary: func(s Summary) { last = s }}
+			go func() {
+				done <- s.Follow(ctx, path, out)
+			}()
+			wait(300)
+
+			// a partial line waits for its end
+			half := len(lines[599]) / 2
+			appendFile(t, path, strings.Join(lines[300:599], "")+lines[599][:half])
+			wait(599)
+			time.Sleep(10 * followInterval)
+			wait(599)
+			appendFile(t, path, lines[599][half:])
+			wait(600)
+
+			// truncated and written again
+			if err := os.WriteFile(path, []byte(strings.Join(lines[600:700], "")), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			wait(700)
+
+			// rotated, the old file gets the rest before the new one is there,
+			// its last line without a newline is dropped when switching to the
+			// new file
+			if err := os.Rename(path, path+".1"); err != nil {
+				t.Fatal(err)
+			}
+			appendFile(t, path+".1", strings.Join(lines[700:750], "")+strings.TrimSuffix(lines[750], "\n"))
+			wait(750)
+			appendFile(t, path, strings.Join(lines[751:800], ""))
+			wait(799)
+
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			done <- nil
+
+			if exp := expected(799, true); out.String() != exp {
+				t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, exp)
+			}
+
+			exp := Summary{}
+			if err := (&Searcher{Filter: all, Unique: unique, Summary: &exp}).Search(strings.NewReader(strings.Join(read[:799], "")), &bytes.Buffer{}); err != nil {
+				t.Fatal(err)
+			}
+			if sum != exp || last != exp {
+				t.Errorf("got summary %+v and running %+v, expected %+v", sum, last, exp)
+			}
+		})
+	}
+}
+
+func TestFollowCompressed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt.gz")
+	if err := os.WriteFile(path, gzipData(t, userData(t)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&Searcher{}).Follow(context.Background(), path, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for following a compressed file")
+	}
+}
+
+func TestFollowRotateUnread(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	appendFile(t, path, "a\n")
+
+	tl := &tail{path: path}
+	if err := tl.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { tl.f.Close() }()
+
+	ctx := context.Background()
+	if l, err := tl.next(ctx); err != nil || string(l) != "a" {
+		t.Fatalf("got %q, %v", l, err)
+	}
+
+	// written after the last read of the old file and before it was seen
+	// replaced
+	appendFile(t, path, "b\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "c\n")
+	if _, err := tl.end(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []string{"b", "c"} {
+		if l, err := tl.next(ctx); err != nil || string(l) != exp {
+			t.Fatalf("expected %q, got %q, %v", exp, l, err)
+		}
+	}
+}
@@ -0,0 +1,587 @@
+package fast
+
+import (
+	"bufio"
+	"bytes"
+	"coursera-go/hw3_bench/ua"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Index maps the distinct browser strings of a users file to the sorted
+// lines of the users having them and keeps the byte offset of every line.
+// Browser conditions of a filter are evaluated once per distinct browser and
+// their posting lists are intersected, only the lines left are read and
+// matched. Lines that fail to decode have no postings, they are kept apart
+// and read by every search, which handles them as Search does. An Index is
+// not safe for concurrent use, but its copies are independent: a search
+// refreshing a copy does not change the original
+type Index struct {
+	src   string
+	path  string
+	stamp stamp
+
+	// offsets of the lines, the last one is the end of the file
+	offsets  []int64
+	browsers []string
+	postings [][]uint32
+	// bad are the sorted lines that failed to decode
+	bad []uint32
+}
+
+// ErrStaleIndex is returned when loading an index of a different source
+var ErrStaleIndex = errors.New("index: source file changed")
+
+// ErrCompressed is returned when indexing a compressed source
+var ErrCompressed = errors.New("index: source is compressed")
+
+const indexMagic = "users.idx/2\n"
+
+// stampSize bytes at the start and at the end of the source are checksummed
+// to catch changes keeping the size and the modification time
+const stampSize = 4096
+
+// stamp identifies the version of the source file the index was built from
+type stamp struct {
+	size  int64
+	mtime int64
+	crc   uint32
+}
+
+func stampFile(f *os.File) (stamp, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return stamp{}, err
+	}
+
+	st := stamp{size: fi.Size(), mtime: fi.ModTime().UnixNano()}
+
+	buf := make([]byte, min(st.size, 2*stampSize))
+	head := len(buf) / 2
+	if _, err := f.ReadAt(buf[:head], 0); err != nil {
+		return stamp{}, err
+	}
+	if _, err := f.ReadAt(buf[head:], st.size-int64(len(buf)-head)); err != nil {
+		return stamp{}, err
+	}
+	st.crc = crc32.ChecksumIEEE(buf)
+
+	return st, nil
+}
+
+// BuildIndex reads the whole users file, bad lines are recorded for the
+// searches. Compressed files can not be indexed, the lines are read by their
+// offsets
+func BuildIndex(src string) (*Index, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := stampFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 4)
+	n, _ := f.ReadAt(head, 0)
+	if compressed(head[:n]) {
+		return nil, fmt.Errorf("%w: %s", ErrCompressed, src)
+	}
+
+	ix := &Index{src: src, stamp: st}
+	ids := map[string]int{}
+	// all the fields are checked, so the browsers of a line some search
+	// can't decode are not seen
+	d := newDecoder(allFields)
+	user := User{}
+	lines := newLineReader(io.NewSectionReader(f, 0, st.size))
+
+	for i := 0; ; i++ {
+		l, err := lines.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if uint64(i) > math.MaxUint32 {
+			return nil, fmt.Errorf("index: more than %d lines", uint32(math.MaxUint32))
+		}
+
+		ix.offsets = append(ix.offsets, lines.start)
+
+		user = User{Browsers: user.Browsers[:0]}
+		if err := d.decode(l, &user); err != nil {
+			ix.bad = append(ix.bad, uint32(i))
+			continue
+		}
+
+		for _, b := range user.Browsers {
+			id, ok := ids[b]
+			if !ok {
+				id = len(ix.browsers)
+				b = strings.Clone(b)
+				ids[b] = id
+				ix.browsers = append(ix.browsers, b)
+				ix.postings = append(ix.postings, nil)
+			}
+
+			// the same browser twice in a user
+			p := ix.postings[id]
+			if len(p) > 0 && p[len(p)-1] == uint32(i) {
+				continue
+			}
+			ix.postings[id] = append(p, uint32(i))
+		}
+	}
+
+	ix.offsets = append(ix.offsets, lines.end)
+	return ix, nil
+}
+
+// OpenIndex loads the index of src from path, src+".idx" if path is empty.
+// A missing, broken or stale index is built again and saved
+func OpenIndex(src, path string) (*Index, error) {
+	if path == "" {
+		path = src + ".idx"
+	}
+
+	ix, err := LoadIndex(src, path)
+	if err == nil {
+		return ix, nil
+	}
+
+	ix, err = BuildIndex(src)
+	if err != nil {
+		return nil, err
+	}
+	ix.path = path
+
+	return ix, ix.save()
+}
+
+// LoadIndex loads the index of src from path, ErrStaleIndex means src was
+// changed after the index was built
+func LoadIndex(src, path string) (*Index, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ix := &Index{src: src, path: path}
+	if err := ix.decode(data); err != nil {
+		return nil, fmt.Errorf("index %s: %w", path, err)
+	}
+
+	fresh, err := ix.fresh()
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrStaleIndex
+	}
+
+	return ix, nil
+}
+
+func (ix *Index) fresh() (bool, error) {
+	f, err := os.Open(ix.src)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	st, err := stampFile(f)
+	return st == ix.stamp, err
+}
+
+// Refresh builds the index again when the source was changed and saves it
+func (ix *Index) Refresh() error {
+	fresh, err := ix.fresh()
+	if err != nil || fresh {
+		return err
+	}
+
+	nix, err := BuildIndex(ix.src)
+	if err != nil {
+		return err
+	}
+	nix.path = ix.path
+	*ix = *nix
+
+	if ix.path == "" {
+		return nil
+	}
+	return ix.save()
+}
+
+// save writes the index next to its final path and renames it, so a reader
+// never sees a partial index and concurrent saves do not mix
+func (ix *Index) save() error {
+	f, err := os.CreateTemp(filepath.Dir(ix.path), filepath.Base(ix.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(ix.encode())
+	if err := errors.Join(err, f.Chmod(0o644), f.Close()); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), ix.path)
+}
+
+// encode lays the index out as the magic, the stamp, the line lengths, then
+// the browsers each with the gaps between its lines, the gaps between the bad
+// lines, all as varints, and a crc32 of everything before it
+func (ix *Index) encode() []byte {
+	b := []byte(indexMagic)
+	b = binary.AppendVarint(b, ix.stamp.size)
+	b = binary.AppendVarint(b, ix.stamp.mtime)
+	b = binary.BigEndian.AppendUint32(b, ix.stamp.crc)
+
+	b = binary.AppendUvarint(b, uint64(len(ix.offsets)-1))
+	for i := 1; i < len(ix.offsets); i++ {
+		b = binary.AppendUvarint(b, uint64(ix.offsets[i]-ix.offsets[i-1]))
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(ix.browsers)))
+	for i, s := range ix.browsers {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+
+		b = appendLines(b, ix.postings[i])
+	}
+	b = appendLines(b, ix.bad)
+
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+func (ix *Index) decode(data []byte) error {
+	if len(data) < len(indexMagic)+4 || string(data[:len(indexMagic)]) != indexMagic {
+		return errors.New("not an index")
+	}
+
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(body):]) {
+		return errors.New("checksum mismatch")
+	}
+
+	r := indexReader{b: body[len(indexMagic):]}
+	ix.stamp.size = r.varint()
+	ix.stamp.mtime = r.varint()
+	ix.stamp.crc = r.uint32()
+
+	n := r.count()
+	ix.offsets = make([]int64, 0, n+1)
+	off := int64(0)
+	ix.offsets = append(ix.offsets, 0)
+	for i := 0; i < n; i++ {
+		off += int64(r.uvarint())
+		ix.offsets = append(ix.offsets, off)
+	}
+
+	nb := r.count()
+	ix.browsers = make([]string, 0, nb)
+	ix.postings = make([][]uint32, 0, nb)
+	for i := 0; i < nb; i++ {
+		ix.browsers = append(ix.browsers, string(r.bytes(r.count())))
+
+		ix.postings = append(ix.postings, r.lines(n))
+	}
+	ix.bad = r.lines(n)
+
+	if r.err == nil && len(r.b) > 0 {
+		r.err = errors.New("trailing data")
+	}
+	if r.err == nil && off != ix.stamp.size {
+		r.err = errors.New("lines do not match the source size")
+	}
+	return r.err
+}
+
+// appendLines appends the number of lines and the gaps between them
+func appendLines(b []byte, lines []uint32) []byte {
+	b = binary.AppendUvarint(b, uint64(len(lines)))
+	prev := uint32(0)
+	for _, line := range lines {
+		b = binary.AppendUvarint(b, uint64(line-prev))
+		prev = line
+	}
+	return b
+}
+
+// indexReader keeps the first error and returns zeros after it
+type indexReader struct {
+	b   []byte
+	err error
+}
+
+func (r *indexReader) fail() {
+	if r.err == nil {
+		r.err = io.ErrUnexpectedEOF
+	}
+	r.b = nil
+}
+
+func (r *indexReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *indexReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// count is a length that must fit into the rest of the data, every element
+// takes at least a byte
+func (r *indexReader) count() int {
+	v := r.uvarint()
+	if v > uint64(len(r.b)) {
+		r.fail()
+		return 0
+	}
+	return int(v)
+}
+
+func (r *indexReader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+// lines reads the lines written by appendLines, of a file of n lines
+func (r *indexReader) lines(n int) []uint32 {
+	p := make([]uint32, r.count())
+	line := uint64(0)
+	for j := range p {
+		line += r.uvarint()
+		if line >= uint64(n) {
+			r.err = errors.New("line out of range")
+		}
+		p[j] = uint32(line)
+	}
+	return p
+}
+
+func (r *indexReader) bytes(n int) []byte {
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+// SearchIndex gives the same output as Search over the source of ix, reading
+// only the lines that may match. The index is built again first if the
+// source was changed
+func (s *Searcher) SearchIndex(ix *Index, w io.Writer) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	if err := ix.Refresh(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(ix.src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	filter := s.filter()
+	o := s.output()
+	d := newDecoder(mask(filter) | o.fields())
+	bad := badLines{s: s}
+	user := User{}
+	buf := []byte{}
+	out := []byte{}
+	found := 0
+
+	bw := bufio.NewWriter(w)
+	if err := o.header(bw); err != nil {
+		return err
+	}
+
+	// every browser is in some good user, so the seen ones are all the
+	// browsers satisfying a condition like in Search, matched users or not.
+	// The bad lines are read too, those this search decodes add to seen
+	conds, seen := ix.match(filter)
+	lines, all := candidates(conds, filter.root)
+	if !all {
+		lines = union(lines, ix.bad)
+	}
+	n := len(lines)
+	if all {
+		n = len(ix.offsets) - 1
+	}
+
+	for j := 0; j < n; j++ {
+		i := j
+		if !all {
+			i = int(lines[j])
+		}
+
+		start, end := ix.offsets[i], ix.offsets[i+1]
+		buf = slices.Grow(buf[:0], int(end-start))[:end-start]
+		if _, err := f.ReadAt(buf, start); err != nil {
+			return err
+		}
+		l := bytes.TrimSuffix(buf, []byte{'\n'})
+
+		user = User{Browsers: user.Browsers[:0]}
+		if err := d.decode(l, &user); err != nil {
+			if err := bad.add(lineError(i, start, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var useen map[string]bool
+		if _, isBad := slices.BinarySearch(ix.bad, uint32(i)); isBad {
+			useen = seen
+		}
+		if !filter.Match(&user, useen) {
+			continue
+		}
+
+		found++
+		out = o.appendUser(out[:0], i, &user)
+		if _, err := bw.Write(out); err != nil {
+			return err
+		}
+	}
+
+	if err := s.footer(o, bw, found, seen); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// match evaluates the browser conditions of f for every distinct browser,
+// conds are the posting lists of the browsers satisfying each condition
+func (ix *Index) match(f *Filter) (conds [][][]uint32, seen map[string]bool) {
+	conds = make([][][]uint32, len(f.browsers))
+	seen = map[string]bool{}
+	e := env{}
+
+	for i, b := range ix.browsers {
+		e.browser = b
+		if f.parse {
+			e.ua = ua.Parse(b)
+		}
+
+		for j, c := range f.browsers {
+			if c.n.eval(&e) {
+				conds[j] = append(conds[j], ix.postings[i])
+				seen[b] = true
+			}
+		}
+	}
+
+	return conds, seen
+}
+
+// candidates returns the sorted lines of the users that may match n, all
+// means that the index does not narrow n down. Browser conditions are exact,
+// && and || of them intersect and merge the lines, anything else may be true
+// for any user
+func candidates(conds [][][]uint32, n *node) (lines []uint32, all bool) {
+	switch n.kind {
+	case nodeBrowser:
+		return merge(conds[bits.TrailingZeros64(n.bit)]), false
+
+	case nodeAnd:
+		l, lall := candidates(conds, n.l)
+		r, rall := candidates(conds, n.r)
+		if lall {
+			return r, rall
+		}
+		if rall {
+			return l, false
+		}
+		return intersect(l, r), false
+
+	case nodeOr:
+		l, lall := candidates(conds, n.l)
+		r, rall := candidates(conds, n.r)
+		if lall || rall {
+			return nil, true
+		}
+		return union(l, r), false
+	}
+
+	return nil, true
+}
+
+func merge(lists [][]uint32) []uint32 {
+	if len(lists) == 1 {
+		return lists[0]
+	}
+
+	rv := []uint32{}
+	for _, p := range lists {
+		rv = append(rv, p...)
+	}
+	slices.Sort(rv)
+	return slices.Compact(rv)
+}
+
+func intersect(a, b []uint32) []uint32 {
+	rv := []uint32{}
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			a = a[1:]
+		case a[0] > b[0]:
+			b = b[1:]
+		default:
+			rv = append(rv, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return rv
+}
+
+func union(a, b []uint32) []uint32 {
+	rv := make([]uint32, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			rv = append(rv, a[0])
+			a = a[1:]
+		case a[0] > b[0]:
+			rv = append(rv, b[0])
+			b = b[1:]
+		default:
+			rv = append(rv, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	rv = append(rv, a...)
+	return append(rv, b...)
+}
@@ -0,0 +1,347 @@
+package fast
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func indexSource(t *testing.T) string {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(t.TempDir(), "users.txt")
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func searchFile(t *testing.T, s *Searcher, src string) string {
+	f, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	out := new(bytes.Buffer)
+	if err := s.Search(f, out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func searchIndex(t *testing.T, s *Searcher, ix *Index) string {
+	out := new(bytes.Buffer)
+	if err := s.SearchIndex(ix, out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestSearchIndex(t *testing.T) {
+	src := indexSource(t)
+	ix, err := OpenIndex(src, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters := []string{
+		`browser~"Android" && browser~"MSIE"`,
+		`browser~"Android" && (browser~"MSIE" || browser~"Opera") && country!="Kenya"`,
+		`browser~"Android" || company=="Flashpoint"`,
+		`!browser~"Android" && browser=="Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 5.1)"`,
+		`any(ua.family=="IE" && ua.version<9) && any(ua.os=="Android")`,
+		`name~"Sharon"`,
+	}
+
+	searchers := []Searcher{
+		{},
+		{Unique: "family"},
+		{Format: "csv", Redact: map[string]Policy{"name": Mask, "email": Hash}, Salt: "pepper"},
+	}
+
+	for _, expr := range filters {
+		for _, s := range searchers {
+			s.Filter = MustCompile(expr)
+			s := &s
+
+			exp := searchFile(t, s, src)
+			got := searchIndex(t, s, ix)
+			if got != exp {
+				t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", expr, got, exp)
+			}
+		}
+	}
+}
+
+func TestIndexCandidates(t *testing.T) {
+	src := indexSource(t)
+	ix, err := BuildIndex(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// substring conditions are exact, so only the matching lines are read
+	conds, _ := ix.match(DefaultFilter)
+	lines, all := candidates(conds, DefaultFilter.root)
+	if all {
+		t.Fatal("expected the index to narrow the default filter down")
+	}
+
+	exp := strings.Count(searchFile(t, &Searcher{}, src), "\n[")
+	if len(lines) != exp {
+		t.Errorf("expected %d lines, got %d", exp, len(lines))
+	}
+
+	f := MustCompile(`name~"x" || browser~"MSIE"`)
+	conds, _ = ix.match(f)
+	if _, all := candidates(conds, f.root); !all {
+		t.Error("expected all the lines for a condition on name")
+	}
+}
+
+func TestIndexPersist(t *testing.T) {
+	src := indexSource(t)
+	path := filepath.Join(t.TempDir(), "users.idx")
+
+	built, err := OpenIndex(src, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadIndex(src, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.encode(), built.encode()) {
+		t.Error("loaded index differs from the built one")
+	}
+	if len(loaded.browsers) != 670 || len(loaded.offsets) != 1001 {
+		t.Errorf("expected 670 browsers and 1000 lines, got %d and %d", len(loaded.browsers), len(loaded.offsets)-1)
+	}
+
+	// broken index files are built again
+	data, _ := os.ReadFile(path)
+	data[len(data)/2] ^= 1
+	os.WriteFile(path, data, 0o644)
+	if _, err := LoadIndex(src, path); err == nil {
+		t.Error("expected error for a broken index")
+	}
+	if _, err := OpenIndex(src, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIndex(src, path); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexStale(t *testing.T) {
+	src := indexSource(t)
+	path := src + ".idx"
+
+	ix, err := OpenIndex(src, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(src)
+	changes := map[string][]byte{
+		"append": append(append([]byte{}, data...),
+			"\n"+`{"browsers":["Android","MSIE"],"name":"New User","email":"new@user.org"}`...),
+		// same size and time, a different first user
+		"rewrite": bytes.Replace(data, []byte("Sharon Crawford"), []byte("Sharon Crawfort"), 1),
+	}
+
+	for name, changed := range changes {
+		if err := os.WriteFile(src, changed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(src, time.Time{}, fi.ModTime())
+
+		if _, err := LoadIndex(src, path); !errors.Is(err, ErrStaleIndex) {
+			t.Errorf("%s: expected ErrStaleIndex, got %v", name, err)
+		}
+
+		s := &Searcher{Filter: MustCompile(`browser~"Android" && browser~"MSIE" || name~"Crawfort"`)}
+		exp := searchFile(t, s, src)
+		got := searchIndex(t, s, ix)
+		if got != exp {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", name, got, exp)
+		}
+
+		// the rebuilt index is saved
+		if _, err := LoadIndex(src, path); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestBuildIndexError(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "users.txt")
+	os.WriteFile(src, []byte(`{"browsers":["a"]}`+"\n"+`{"browsers":[1]}`), 0o644)
+
+	// the bad line is kept for the searches, not an error of the index
+	ix, err := BuildIndex(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.bad) != 1 || ix.bad[0] != 1 {
+		t.Errorf("expected bad line 1, got %v", ix.bad)
+	}
+
+	loaded := &Index{}
+	if err := loaded.decode(ix.encode()); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(loaded.bad, ix.bad) {
+		t.Errorf("expected bad lines %v after decode, got %v", ix.bad, loaded.bad)
+	}
+
+	var lerr *LineError
+	if err := (&Searcher{}).SearchIndex(ix, io.Discard); !errors.As(err, &lerr) || lerr.Line != 1 {
+		t.Errorf("expected error at line 1, got %v", err)
+	}
+}
+
+func TestSearchIndexBadLines(t *testing.T) {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the browsers are in no other line: the first one is not decoded by
+	// Search so they are not counted, the second only fails on a field the
+	// search skips so they are
+	bad := []string{
+		`{"browsers":["Android Lonely/1.0","MSIE Lonely"],"name":1,"email":"a@b.c"}`,
+		`{"browsers":["Android Alone/1.0","MSIE Alone"],"name":"Alone","email":"a@b.c","phone":1}`,
+	}
+	lines := strings.Split(string(data), "\n")
+	lines = append(lines[:3], append(bad[:1], lines[3:]...)...)
+	lines = append(lines[:500], append(bad[1:], lines[500:]...)...)
+
+	src := filepath.Join(t.TempDir(), "users.txt")
+	if err := os.WriteFile(src, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := BuildIndex(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.bad) != 2 || ix.bad[0] != 3 || ix.bad[1] != 500 {
+		t.Fatalf("expected bad lines 3 and 500, got %v", ix.bad)
+	}
+
+	for _, expr := range []string{
+		`browser~"Android" && browser~"MSIE"`,
+		`browser=="MSIE Lonely" || browser=="MSIE Alone"`,
+		`name~"Sharon"`,
+	} {
+		errs := []int{}
+		s := &Searcher{Filter: MustCompile(expr), Lenient: true, OnError: func(err *LineError) { errs = append(errs, err.Line) }}
+		got := searchIndex(t, s, ix)
+		if len(errs) != 1 || errs[0] != 3 {
+			t.Errorf("%s: expected bad line 3, got %v", expr, errs)
+		}
+
+		s.OnError = nil
+		if exp := searchFile(t, s, src); got != exp {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", expr, got, exp)
+		}
+	}
+}
+
+// failWriter fails after n bytes
+type failWriter struct {
+	n int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("write failed")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestSearchIndexErrors(t *testing.T) {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+
+	// the browsers are checked when the index is built, the name only when
+	// the line is found
+	k := 0
+	for !strings.Contains(lines[k], "Android") || !strings.Contains(lines[k], "MSIE") {
+		k++
+	}
+	u := User{}
+	if err := u.UnmarshalJSON([]byte(lines[k])); err != nil {
+		t.Fatal(err)
+	}
+	browsers, _ := json.Marshal(u.Browsers)
+	bad := `{"browsers":` + string(browsers) + `,"name":1}`
+	lines = append(lines[:k+1], append([]string{bad}, lines[k+1:]...)...)
+
+	src := filepath.Join(t.TempDir(), "users.txt")
+	if err := os.WriteFile(src, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := BuildIndex(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lerr *LineError
+	if err := (&Searcher{}).SearchIndex(ix, io.Discard); !errors.As(err, &lerr) || lerr.Line != k+1 {
+		t.Fatalf("expected error at line %d, got %v", k+1, err)
+	}
+
+	errs := []*LineError{}
+	s := &Searcher{Lenient: true, OnError: func(err *LineError) { errs = append(errs, err) }}
+	got := searchIndex(t, s, ix)
+	if len(errs) != 1 || errs[0].Line != k+1 {
+		t.Errorf("expected bad line %d, got %v", k+1, errs)
+	}
+	if exp := searchFile(t, &Searcher{Lenient: true}, src); got != exp {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, exp)
+	}
+
+	for _, n := range []int{0, len(got) / 2, len(got) - 1} {
+		if err := s.SearchIndex(ix, &failWriter{n}); err == nil {
+			t.Errorf("expected write error after %d bytes", n)
+		}
+	}
+}
+
+func BenchmarkSearchIndex(b *testing.B) {
+	ix, err := BuildIndex("../data/users.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := &Searcher{}
+
+	for i := 0; i < b.N; i++ {
+		if err := s.SearchIndex(ix, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package fast
+
+import (
+	"bufio"
+	"io"
+)
+
+const readerSize = 64 * 1024
+
+// lineReader returns lines without the trailing newline. A line stays valid
+// until the next call, lines longer than the bufio buffer are collected into
+// buf which is reused as well. start is the offset of the returned line in
+// the input
+type lineReader struct {
+	r     *bufio.Reader
+	buf   []byte
+	start int64
+	end   int64
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, readerSize)}
+}
+
+func (l *lineReader) next() ([]byte, error) {
+	line, err := l.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		l.buf = append(l.buf[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = l.r.ReadSlice('\n')
+			l.buf = append(l.buf, line...)
+		}
+		line = l.buf
+	}
+
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	l.start = l.end
+	l.end += int64(len(line))
+
+	if line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+
+	return line, nil
+}
@@ -0,0 +1,349 @@
+package fast
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy is how a personal field of the found users is shown
+type Policy int
+
+const (
+	// Keep shows the value as is
+	Keep Policy = iota
+	// At replaces @ with " [at] ", the default for email
+	At
+	// Mask keeps the first letter of every word of a name and of an email,
+	// the domain of an email and the last two digits of a phone
+	Mask
+	// Hash shows the first 16 hex digits of the HMAC-SHA256 of the value
+	// with Searcher.Salt, so equal values can still be matched
+	Hash
+	// Drop leaves the field out
+	Drop
+)
+
+var policies = []string{"keep", "at", "mask", "hash", "drop"}
+
+func ParsePolicy(s string) (Policy, error) {
+	for i, name := range policies {
+		if s == name {
+			return Policy(i), nil
+		}
+	}
+	return Keep, fmt.Errorf("unknown policy %q", s)
+}
+
+func (p Policy) String() string {
+	if p < 0 || int(p) >= len(policies) {
+		return "policy(" + strconv.Itoa(int(p)) + ")"
+	}
+	return policies[p]
+}
+
+var formats = map[string]bool{"": true, "text": true, "jsonl": true, "csv": true}
+
+// redacted are the fields Searcher.Redact may have policies for
+var redacted = map[string]int{"name": fieldName, "email": fieldEmail, "phone": fieldPhone}
+
+func (s *Searcher) checkOutput() error {
+	if !formats[s.Format] {
+		return fmt.Errorf("unknown format %q", s.Format)
+	}
+
+	for field, p := range s.Redact {
+		if _, ok := redacted[field]; !ok {
+			return fmt.Errorf("no redaction for field %q", field)
+		}
+		if p < Keep || p > Drop {
+			return fmt.Errorf("unknown policy %v for %s", p, field)
+		}
+		if p == Hash && s.Salt == "" {
+			return fmt.Errorf("hash policy for %s needs a salt", field)
+		}
+	}
+
+	return nil
+}
+
+// output formats the found users, it keeps the hash state so every goroutine
+// needs its own
+type output struct {
+	format string
+	// policies by field, phone is dropped in the text format
+	policy [fieldPhone + 1]Policy
+	mac    hash.Hash
+	in     []byte
+	sum    []byte
+	tmp    []byte
+}
+
+func (s *Searcher) output() *output {
+	o := &output{format: s.Format}
+	if o.format == "" {
+		o.format = "text"
+	}
+
+	o.policy[fieldEmail] = At
+	for field, p := range s.Redact {
+		o.policy[redacted[field]] = p
+	}
+	if o.format == "text" {
+		o.policy[fieldPhone] = Drop
+	}
+
+	for _, p := range o.policy {
+		if p == Hash {
+			o.mac = hmac.New(sha256.New, []byte(s.Salt))
+		}
+	}
+
+	return o
+}
+
+// fields are the fields to decode for the output
+func (o *output) fields() uint {
+	m := uint(0)
+	for _, f := range []int{fieldName, fieldEmail, fieldPhone} {
+		if o.policy[f] != Drop {
+			m |= 1 << f
+		}
+	}
+	return m
+}
+
+func (o *output) columns() []string {
+	cols := []string{"line"}
+	for _, f := range []string{"name", "email", "phone"} {
+		if o.policy[redacted[f]] != Drop {
+			cols = append(cols, f)
+		}
+	}
+	return cols
+}
+
+// header is written before the users, only text has a footer with the number
+// of the unique browsers
+func (o *output) header(w io.Writer) error {
+	var err error
+	switch o.format {
+	case "text":
+		_, err = fmt.Fprintln(w, "found users:")
+	case "csv":
+		_, err = fmt.Fprintln(w, strings.Join(o.columns(), ","))
+	}
+	return err
+}
+
+func (o *output) footer(w io.Writer, unique int) error {
+	if o.format != "text" {
+		return nil
+	}
+	_, err := fmt.Fprintln(w, "\nTotal unique browsers", unique)
+	return err
+}
+
+func (o *output) appendUser(b []byte, i int, u *User) []byte {
+	switch o.format {
+	case "jsonl":
+		return o.appendJSON(b, i, u)
+	case "csv":
+		return o.appendCSV(b, i, u)
+	}
+
+	b = append(b, '[')
+	b = strconv.AppendInt(b, int64(i), 10)
+	b = append(b, ']')
+	if o.policy[fieldName] != Drop {
+		b = append(b, ' ')
+		b = o.appendField(b, fieldName, u.Name)
+	}
+	if o.policy[fieldEmail] != Drop {
+		b = append(b, " <"...)
+		b = o.appendField(b, fieldEmail, u.Email)
+		b = append(b, '>')
+	}
+	return append(b, '\n')
+}
+
+func (o *output) appendJSON(b []byte, i int, u *User) []byte {
+	b = append(b, `{"line":`...)
+	b = strconv.AppendInt(b, int64(i), 10)
+
+	for _, f := range []struct {
+		key   string
+		field int
+		value string
+	}{
+		{`,"name":`, fieldName, u.Name},
+		{`,"email":`, fieldEmail, u.Email},
+		{`,"phone":`, fieldPhone, u.Phone},
+	} {
+		if o.policy[f.field] == Drop {
+			continue
+		}
+		b = append(b, f.key...)
+		o.tmp = o.appendField(o.tmp[:0], f.field, f.value)
+		b = appendJSONString(b, o.tmp)
+	}
+
+	return append(b, "}\n"...)
+}
+
+func (o *output) appendCSV(b []byte, i int, u *User) []byte {
+	b = strconv.AppendInt(b, int64(i), 10)
+
+	for _, f := range []struct {
+		field int
+		value string
+	}{
+		{fieldName, u.Name},
+		{fieldEmail, u.Email},
+		{fieldPhone, u.Phone},
+	} {
+		if o.policy[f.field] == Drop {
+			continue
+		}
+		b = append(b, ',')
+		o.tmp = o.appendField(o.tmp[:0], f.field, f.value)
+		b = appendCSVField(b, o.tmp)
+	}
+
+	return append(b, '\n')
+}
+
+func (o *output) appendField(b []byte, field int, v string) []byte {
+	switch o.policy[field] {
+	case At:
+		if at := strings.IndexByte(v, '@'); at >= 0 {
+			b = append(b, v[:at]...)
+			b = append(b, " [at] "...)
+			return append(b, v[at+1:]...)
+		}
+	case Mask:
+		return appendMasked(b, field, v)
+	case Hash:
+		// a copy, hmac has no WriteString and the conversion allocates
+		o.in = append(o.in[:0], v...)
+		o.mac.Reset()
+		o.mac.Write(o.in)
+		o.sum = o.mac.Sum(o.sum[:0])
+		var digits [16]byte
+		hex.Encode(digits[:], o.sum[:8])
+		return append(b, digits[:]...)
+	}
+	return append(b, v...)
+}
+
+func appendMasked(b []byte, field int, v string) []byte {
+	switch field {
+	case fieldEmail:
+		if at := strings.LastIndexByte(v, '@'); at >= 0 {
+			b = appendMaskedWords(b, v[:at])
+			return append(b, v[at:]...)
+		}
+	case fieldPhone:
+		keep := len(v)
+		for digits := 0; keep > 0 && digits < 2; keep-- {
+			if isDigit(v[keep-1]) {
+				digits++
+			}
+		}
+		for i := 0; i < keep; i++ {
+			if isDigit(v[i]) {
+				b = append(b, '*')
+			} else {
+				b = append(b, v[i])
+			}
+		}
+		return append(b, v[keep:]...)
+	}
+	return appendMaskedWords(b, v)
+}
+
+// appendMaskedWords keeps the first rune of every word and the characters
+// other than letters and digits
+func appendMaskedWords(b []byte, v string) []byte {
+	first := true
+	for _, r := range v {
+		switch {
+		case r == ' ':
+			first = true
+		case first:
+			first = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			r = '*'
+		}
+		b = utf8.AppendRune(b, r)
+	}
+	return b
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// appendJSONString appends s quoted, invalid UTF-8 is replaced like
+// encoding/json does
+func appendJSONString(b, s []byte) []byte {
+	const hexDigits = "0123456789abcdef"
+
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, n := utf8.DecodeRune(s[i:])
+			if r == utf8.RuneError && n == 1 {
+				b = append(b, `\ufffd`...)
+			} else {
+				b = append(b, s[i:i+n]...)
+			}
+			i += n
+			continue
+		}
+
+		switch {
+		case c == '"' || c == '\\':
+			b = append(b, '\\', c)
+		case c == '\n':
+			b = append(b, `\n`...)
+		case c == '\r':
+			b = append(b, `\r`...)
+		case c == '\t':
+			b = append(b, `\t`...)
+		case c < ' ':
+			b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+		default:
+			b = append(b, c)
+		}
+		i++
+	}
+	return append(b, '"')
+}
+
+// appendCSVField quotes s like encoding/csv does
+func appendCSVField(b, s []byte) []byte {
+	quote := len(s) > 0 && (s[0] == ' ' || s[0] == '\t') ||
+		bytes.ContainsAny(s, "\",\r\n")
+	if !quote {
+		return append(b, s...)
+	}
+
+	b = append(b, '"')
+	for _, c := range s {
+		if c == '"' {
+			b = append(b, '"')
+		}
+		b = append(b, c)
+	}
+	return append(b, '"')
+}
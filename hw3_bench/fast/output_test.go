@@ -0,0 +1,204 @@
+package fast
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+var outputInput = `{"browsers":["Android","MSIE"],"name":"Sharon Crawford","email":"JonathanMorris@Muxo.edu","phone":"176-88-49"}
+{"browsers":["Opera"],"name":"Nobody","email":"no@body.org"}
+{"browsers":["MSIE 8","Android 4"],"name":"Zoë \"Q\", Jr.","email":"zoe.q@example.com","phone":"+7 (900) 123-45-67"}`
+
+func TestOutputFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		redact map[string]Policy
+		exp    string
+	}{
+		{"text", "", nil, `found users:
+[0] Sharon Crawford <JonathanMorris [at] Muxo.edu>
+[2] Zoë "Q", Jr. <zoe.q [at] example.com>
+
+Total unique browsers 4
+`},
+		{"text masked", "text", map[string]Policy{"name": Mask, "email": Mask, "phone": Keep}, `found users:
+[0] S***** C******* <J*************@Muxo.edu>
+[2] Z** "*", J*. <z**.*@example.com>
+
+Total unique browsers 4
+`},
+		{"text dropped", "text", map[string]Policy{"name": Drop, "email": Keep}, `found users:
+[0] <JonathanMorris@Muxo.edu>
+[2] <zoe.q@example.com>
+
+Total unique browsers 4
+`},
+		{"jsonl", "jsonl", map[string]Policy{"phone": Mask}, `{"line":0,"name":"Sharon Crawford","email":"JonathanMorris [at] Muxo.edu","phone":"***-**-49"}
+{"line":2,"name":"Zoë \"Q\", Jr.","email":"zoe.q [at] example.com","phone":"+* (***) ***-**-67"}
+`},
+		{"jsonl hashed", "jsonl", map[string]Policy{"name": Drop, "email": Hash, "phone": Drop}, `{"line":0,"email":"1aeb20590a99501b"}
+{"line":2,"email":"4dacaa87631505b7"}
+`},
+		{"csv", "csv", map[string]Policy{"email": Keep}, `line,name,email,phone
+0,Sharon Crawford,JonathanMorris@Muxo.edu,176-88-49
+2,"Zoë ""Q"", Jr.",zoe.q@example.com,+7 (900) 123-45-67
+`},
+		{"csv dropped", "csv", map[string]Policy{"name": Drop, "phone": Drop}, `line,email
+0,JonathanMorris [at] Muxo.edu
+2,zoe.q [at] example.com
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Searcher{Format: tt.format, Redact: tt.redact, Salt: "pepper"}
+
+			out := new(bytes.Buffer)
+			if err := s.Search(strings.NewReader(outputInput), out); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.exp {
+				t.Errorf("expected\n%s\ngot\n%s", tt.exp, out)
+			}
+
+			par := new(bytes.Buffer)
+			if err := s.SearchParallel(strings.NewReader(outputInput), par, 2); err != nil {
+				t.Fatal(err)
+			}
+			if par.String() != out.String() {
+				t.Errorf("parallel results not match\nGot:\n%v\nExpected:\n%v", par, out)
+			}
+		})
+	}
+}
+
+func TestOutputParses(t *testing.T) {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// invalid UTF-8 and control characters in the name
+	data = append(data, "\n"+`{"browsers":["Android MSIE"],"name":"a\u0001\ud800b\"","email":"x@y"}`...)
+	filter := MustCompile(`browser~"Android" || browser~"MSIE"`)
+
+	s := &Searcher{Filter: filter, Format: "jsonl", Redact: map[string]Policy{"email": Keep}}
+	out := new(bytes.Buffer)
+	if err := s.Search(bytes.NewReader(data), out); err != nil {
+		t.Fatal(err)
+	}
+
+	users := 0
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		rec := struct{ Line int }{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		users++
+	}
+
+	s.Format = "csv"
+	out.Reset()
+	if err := s.Search(bytes.NewReader(data), out); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != users+1 {
+		t.Errorf("expected %d csv records, got %d", users+1, len(recs))
+	}
+	if last := recs[len(recs)-1]; last[1] != "a\x01�b\"" {
+		t.Errorf("unexpected name %q", last[1])
+	}
+}
+
+func TestOutputErrors(t *testing.T) {
+	searchers := map[string]*Searcher{
+		"format": {Format: "xml"},
+		"field":  {Redact: map[string]Policy{"country": Mask}},
+		"policy": {Redact: map[string]Policy{"name": Policy(42)}},
+		"salt":   {Redact: map[string]Policy{"name": Hash}},
+	}
+
+	for name, s := range searchers {
+		if err := s.Search(strings.NewReader(outputInput), new(bytes.Buffer)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	for i, name := range []string{"keep", "at", "mask", "hash", "drop"} {
+		p, err := ParsePolicy(name)
+		if err != nil || p != Policy(i) || p.String() != name {
+			t.Errorf("%s: got %v, %v", name, p, err)
+		}
+	}
+	if _, err := ParsePolicy("blur"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestOutputAllocs(t *testing.T) {
+	s := &Searcher{Format: "jsonl", Redact: map[string]Policy{"name": Mask, "email": Hash}, Salt: "pepper"}
+	o := s.output()
+	out := o.appendUser(nil, 1, &filterUser)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		out = o.appendUser(out[:0], 1, &filterUser)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	src := indexSource(t)
+	ix, err := OpenIndex(src, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := searchFile(t, &Searcher{}, src)
+	exp := Summary{Users: strings.Count(text, "\n[")}
+	fmt.Sscanf(text[strings.LastIndex(text, "Total"):], "Total unique browsers %d", &exp.Unique)
+	if exp.Users == 0 || exp.Unique == 0 {
+		t.Fatalf("bad text output:\n%s", text)
+	}
+
+	for name, search := range map[string]func(s *Searcher) error{
+		"search": func(s *Searcher) error {
+			f, err := os.Open(src)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return s.Search(f, io.Discard)
+		},
+		"parallel": func(s *Searcher) error {
+			f, err := os.Open(src)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return s.SearchParallel(f, io.Discard, 3)
+		},
+		"index": func(s *Searcher) error {
+			return s.SearchIndex(ix, io.Discard)
+		},
+	} {
+		got := Summary{}
+		if err := search(&Searcher{Format: "jsonl", Summary: &got}); err != nil {
+			t.Fatal(err)
+		}
+		if got != exp {
+			t.Errorf("%s: got %+v, expected %+v", name, got, exp)
+		}
+	}
+}
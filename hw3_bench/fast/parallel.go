@@ -0,0 +1,240 @@
+package fast
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+var chunkSize = 1 << 20
+
+type chunk struct {
+	seq  int
+	line int
+	off  int64
+	data []byte
+	out  []byte
+	seen map[string]bool
+	bad  []*LineError
+	err  error
+
+	// found is the number of users in out
+	found int
+}
+
+// chunker cuts the input into chunks that end on a line boundary
+type chunker struct {
+	r    io.Reader
+	tail []byte
+	line int
+	off  int64
+	eof  bool
+}
+
+func (ch *chunker) next(c *chunk) (bool, error) {
+	c.data = append(c.data[:0], ch.tail...)
+	ch.tail = ch.tail[:0]
+
+	for !ch.eof {
+		if len(c.data) >= chunkSize {
+			if i := bytes.LastIndexByte(c.data, '\n'); i >= 0 {
+				ch.tail = append(ch.tail, c.data[i+1:]...)
+				c.data = c.data[:i+1]
+				break
+			}
+		}
+
+		if len(c.data) == cap(c.data) {
+			c.data = slices.Grow(c.data, chunkSize)
+		}
+
+		n, err := ch.r.Read(c.data[len(c.data):cap(c.data)])
+		c.data = c.data[:len(c.data)+n]
+		if err == io.EOF {
+			ch.eof = true
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	if len(c.data) == 0 {
+		return false, nil
+	}
+
+	c.line, c.off = ch.line, ch.off
+	ch.line += bytes.Count(c.data, []byte{'\n'})
+	ch.off += int64(len(c.data))
+
+	return true, nil
+}
+
+// search collects the bad lines when lenient and stops on the first one
+// otherwise
+func (c *chunk) search(filter *Filter, d *decoder, o *output, lenient bool) {
+	c.out = c.out[:0]
+	c.found = 0
+	c.bad = c.bad[:0]
+	c.err = nil
+	clear(c.seen)
+
+	user := User{}
+	data := c.data
+	start := c.off
+
+	for i := c.line; len(data) > 0; i++ {
+		l := data
+		if j := bytes.IndexByte(data, '\n'); j >= 0 {
+			l, data = data[:j], data[j+1:]
+		} else {
+			data = nil
+		}
+		lineStart := start
+		start += int64(len(l) + 1)
+
+		user = User{Browsers: user.Browsers[:0]}
+		if err := d.decode(l, &user); err != nil {
+			err := lineError(i, lineStart, err)
+			if !lenient {
+				c.err = err
+				return
+			}
+			c.bad = append(c.bad, err)
+			continue
+		}
+
+		if filter.Match(&user, c.seen) {
+			c.out = o.appendUser(c.out, i, &user)
+			c.found++
+		}
+	}
+}
+
+// SearchParallel parses line aligned chunks of r on workers goroutines and
+// writes the same output as Search. workers <= 0 means GOMAXPROCS
+func SearchParallel(r io.Reader, w io.Writer, workers int) error {
+	return (&Searcher{}).SearchParallel(r, w, workers)
+}
+
+func (s *Searcher) SearchParallel(r io.Reader, w io.Writer, workers int) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	r, closer, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	filter := s.filter()
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	free := make(chan *chunk, 2*workers)
+	for i := 0; i < cap(free); i++ {
+		free <- &chunk{seen: map[string]bool{}}
+	}
+
+	todo := make(chan *chunk, cap(free))
+	done := make(chan *chunk, cap(free))
+
+	// stop is closed on the first error, so the rest of r is not read
+	stop := make(chan struct{})
+
+	var readErr error
+	go func() {
+		defer close(todo)
+
+		ch := chunker{r: r}
+		for seq := 0; ; seq++ {
+			var c *chunk
+			select {
+			case c = <-free:
+			case <-stop:
+				return
+			}
+
+			ok, err := ch.next(c)
+			if !ok {
+				readErr = err
+				return
+			}
+
+			c.seq = seq
+			todo <- c
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o := s.output()
+			d := newDecoder(mask(filter) | o.fields())
+			for c := range todo {
+				c.search(filter, d, o, s.Lenient)
+				done <- c
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	o := s.output()
+	o.header(w)
+
+	found := 0
+	bad := badLines{s: s}
+	seen := map[string]bool{}
+	pending := map[int]*chunk{}
+	next := 0
+
+	for c := range done {
+		pending[c.seq] = c
+
+		for c, ok := pending[next]; ok; c, ok = pending[next] {
+			delete(pending, next)
+			next++
+
+			if err == nil {
+				for _, e := range c.bad {
+					if err = bad.add(e); err != nil {
+						break
+					}
+				}
+				if err == nil {
+					err = c.err
+				}
+				if err == nil {
+					_, err = w.Write(c.out)
+				}
+				if err != nil {
+					close(stop)
+				}
+			}
+
+			found += c.found
+			for b := range c.seen {
+				seen[b] = true
+			}
+
+			free <- c
+		}
+	}
+
+	if err == nil {
+		err = readErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.footer(o, w, found, seen)
+}
@@ -0,0 +1,49 @@
+package fast
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestSearchParallel(t *testing.T) {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Repeat(append(data, '\n'), 3)
+
+	exp := new(bytes.Buffer)
+	if err := Search(bytes.NewReader(data), exp); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(size int) { chunkSize = size }(chunkSize)
+
+	for _, size := range []int{1, 100, 4096, 1 << 20} {
+		for _, workers := range []int{1, 3, 8} {
+			t.Run(fmt.Sprintf("%d/%d", size, workers), func(t *testing.T) {
+				chunkSize = size
+
+				got := new(bytes.Buffer)
+				if err := SearchParallel(bytes.NewReader(data), got, workers); err != nil {
+					t.Fatal(err)
+				}
+
+				if got.String() != exp.String() {
+					t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, exp)
+				}
+			})
+		}
+	}
+}
+
+func TestSearchParallelError(t *testing.T) {
+	data := []byte("{\"browsers\":[]}\n{\"browsers\":[]}\n{broken\n{\"browsers\":[]}")
+
+	err := SearchParallel(bytes.NewReader(data), new(bytes.Buffer), 2)
+	if err == nil {
+		t.Fatalf("exp parse error")
+	}
+}
@@ -0,0 +1,185 @@
+package fast
+
+import (
+	"coursera-go/hw3_bench/ua"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Searcher holds the search options, zero value searches with DefaultFilter
+// and counts distinct browser strings
+type Searcher struct {
+	Filter *Filter
+
+	// Unique counts the seen browsers by the parsed user agent instead of the
+	// raw string: family, version (family and major version), os or device
+	Unique string
+
+	// Lenient skips the lines that fail to decode and passes them to OnError.
+	// More than MaxErrors bad lines stop the search with ErrTooManyErrors,
+	// zero means no limit
+	Lenient   bool
+	MaxErrors int
+	OnError   func(err *LineError)
+
+	// Format of the found users: text as SlowSearch, jsonl or csv. Only text
+	// has the number of the unique browsers at the end
+	Format string
+
+	// Redact sets the policies for name, email and phone. Email is At by
+	// default, phone is shown only in jsonl and csv. Salt is the key of Hash
+	Redact map[string]Policy
+	Salt   string
+
+	// Summary, when set, gets the number of the found users and of the unique
+	// browsers, which only the text format writes. OnSummary gets the running
+	// totals of Follow
+	Summary   *Summary
+	OnSummary func(sum Summary)
+}
+
+// Summary of a search
+type Summary struct {
+	Users  int
+	Unique int
+}
+
+var uniqueKeys = map[string]func(a ua.UA) string{
+	"family":  func(a ua.UA) string { return a.Family },
+	"version": func(a ua.UA) string { return a.Family + " " + strconv.Itoa(a.Version.Major) },
+	"os":      func(a ua.UA) string { return a.OS },
+	"device":  func(a ua.UA) string { return a.Device },
+}
+
+func (s *Searcher) check() error {
+	if _, ok := uniqueKeys[s.Unique]; s.Unique != "" && !ok {
+		return fmt.Errorf("unknown unique key %q", s.Unique)
+	}
+	return s.checkOutput()
+}
+
+// unique counts the seen browsers, parsing only once at the end keeps the
+// search loop free of the parser when the filter does not need it
+func (s *Searcher) unique(seen map[string]bool) int {
+	key, ok := uniqueKeys[s.Unique]
+	if !ok {
+		return len(seen)
+	}
+
+	keys := map[string]bool{}
+	for b := range seen {
+		keys[key(ua.Parse(b))] = true
+	}
+	return len(keys)
+}
+
+// CountUnique counts the browsers as the searches do for the footer
+func (s *Searcher) CountUnique(browsers map[string]bool) (int, error) {
+	if err := s.check(); err != nil {
+		return 0, err
+	}
+	return s.unique(browsers), nil
+}
+
+// footer fills the summary and writes the footer of o
+func (s *Searcher) footer(o *output, w io.Writer, users int, seen map[string]bool) error {
+	unique := s.unique(seen)
+	if s.Summary != nil {
+		*s.Summary = Summary{Users: users, Unique: unique}
+	}
+	return o.footer(w, unique)
+}
+
+// mask is the set of fields to decode, the output needs name and email
+func mask(f *Filter) uint {
+	return f.fields | 1<<fieldBrowser | 1<<fieldName | 1<<fieldEmail
+}
+
+func (s *Searcher) filter() *Filter {
+	if s.Filter == nil {
+		return DefaultFilter
+	}
+	return s.Filter
+}
+
+// Search streams the users from r line by line, memory does not depend on
+// the input size
+func Search(r io.Reader, w io.Writer) error {
+	return (&Searcher{}).Search(r, w)
+}
+
+func (s *Searcher) Search(r io.Reader, w io.Writer) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	filter := s.filter()
+	o := s.output()
+	seen := map[string]bool{}
+	out := []byte{}
+	found := 0
+
+	if err := o.header(w); err != nil {
+		return err
+	}
+
+	err := s.each(r, mask(filter)|o.fields(), func(i int, u *User) error {
+		if !filter.Match(u, seen) {
+			return nil
+		}
+
+		found++
+		out = o.appendUser(out[:0], i, u)
+		_, err := w.Write(out)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.footer(o, w, found, seen)
+}
+
+// Each calls fn for every user in r with all the fields decoded, bad lines
+// are handled as in Search. The user and its strings are valid only until fn
+// returns
+func (s *Searcher) Each(r io.Reader, fn func(line int, u *User) error) error {
+	return s.each(r, allFields, fn)
+}
+
+func (s *Searcher) each(r io.Reader, mask uint, fn func(i int, u *User) error) error {
+	r, closer, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	d := newDecoder(mask)
+	bad := badLines{s: s}
+	user := User{}
+	lines := newLineReader(r)
+
+	for i := 0; ; i++ {
+		l, err := lines.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		user = User{Browsers: user.Browsers[:0]}
+		err = d.decode(l, &user)
+		if err != nil {
+			if err := bad.add(lineError(i, lines.start, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := fn(i, &user); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package gen
+
+// DefaultBrowsers is a mix of desktop, mobile and bot user agents, the most
+// frequent ones of data/users.txt first. BrowsersFrom gives the whole file
+var DefaultBrowsers = []Browser{
+	{"Mozilla/5.0 (iPad; U; CPU OS 3_2 like Mac OS X; en-us) AppleWebKit/531.21.10 (KHTML, like Gecko) Version/4.0.4 Mobile/7B334b Safari/531.21.10", 22},
+	{"Mozilla/4.0 (compatible; MSIE 6.0; Windows CE; IEMobile 6.12; Microsoft ZuneHD 4.3)", 21},
+	{"Mozilla/5.0 (Symbian/3; Series60/5.2 NokiaN8-00/014.002; Profile/MIDP-2.1 Configuration/CLDC-1.1; en-us) AppleWebKit/525 (KHTML, like Gecko) Version/3.0 BrowserNG/7.2.6.4 3gpp-gba", 19},
+	{"Mozilla/5.0 (SymbianOS/9.2; U; Series60/3.1 NokiaE90-1/07.24.0.3; Profile/MIDP-2.0 Configuration/CLDC-1.1 ) AppleWebKit/413 (KHTML, like Gecko) Safari/413 UP.Link/6.2.3.18.0", 17},
+	{"Mozilla/5.0 (iPad; U; CPU OS 4_2_1 like Mac OS X; ja-jp) AppleWebKit/533.17.9 (KHTML, like Gecko) Version/5.0.2 Mobile/8C148 Safari/6533.18.5", 17},
+	{"Opera/9.80 (Android; Opera Mini/7.5.33361/31.1543; U; en) Presto/2.8.119 Version/11.1010", 16},
+	{"Mozilla/5.0 (Linux; U; Android 2.0; en-us; Droid Build/ESD20) AppleWebKit/530.17 (KHTML, like Gecko) Version/4.0 Mobile Safari/530.17", 16},
+	{"Mozilla/5.0 (compatible; MSIE 10.0; Windows Phone 8.0; Trident/6.0; IEMobile/10.0; ARM; Touch; NOKIA; Lumia 920)", 16},
+	{"Opera/9.80 (S60; SymbOS; Opera Mobi/499; U; ru) Presto/2.4.18 Version/10.00", 15},
+	{"Mozilla/5.0 (compatible; MSIE 9.0; Windows Phone OS 7.5; Trident/5.0; IEMobile/9.0)", 15},
+	{"Mozilla/5.0 (X11; U; Linux x86_64; en-US) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/30.0.1599.114 Safari/537.36 Puffin/4.5.0IT", 15},
+	{"Mozilla/5.0 (iPad; CPU OS 6_0 like Mac OS X) AppleWebKit/536.26 (KHTML, like Gecko) Version/6.0 Mobile/10A5355d Safari/8536.25", 15},
+	{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2227.0 Safari/537.36", 10},
+	{"LG-LX550 AU-MIC-LX550/2.0 MMP/2.0 Profile/MIDP-2.0 Configuration/CLDC-1.1", 10},
+	{"Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1", 10},
+	{"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; MATBJS; rv:11.0) like Gecko", 10},
+	{"Mozilla/5.0 (Linux; Android 4.4.2; SM-T530 Build/KOT49H) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/35.0.1916.141 Safari/537.36", 8},
+	{"Mozilla/5.0 (Linux; U; Android 4.0.3; ko-kr; LG-L160L Build/IML74K) AppleWebKit/534.30 (KHTML, like Gecko) Version/4.0 Mobile Safari/534.30", 8},
+	{"Mozilla/5.0 (compatible; MSIE 10.0; Windows NT 6.1; Trident/6.0)", 8},
+	{"Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 6.1; Trident/4.0; SLCC2; .NET CLR 2.0.50727)", 8},
+	{"Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 5.1)", 6},
+	{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_9_3) AppleWebKit/537.75.14 (KHTML, like Gecko) Version/7.0.3 Safari/7046A194A", 8},
+	{"Mozilla/5.0 (Windows NT 6.1; WOW64; rv:40.0) Gecko/20100101 Firefox/40.1", 8},
+	{"Mozilla/5.0 (Windows NT 6.3; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/37.0.2049.0 Safari/537.36", 8},
+	{"Opera/9.80 (Windows NT 6.0) Presto/2.12.388 Version/12.14", 6},
+	{"Mozilla/5.0 (BlackBerry; U; BlackBerry 9900; en) AppleWebKit/534.11+ (KHTML, like Gecko) Version/7.1.0.346 Mobile Safari/534.11+", 6},
+	{"Googlebot/2.1 (+http://www.google.com/bot.html)", 4},
+}
+
+var firstNames = []string{
+	"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda",
+	"William", "Elizabeth", "David", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+	"Thomas", "Sarah", "Charles", "Karen", "Joshua", "Nancy", "Jonathan", "Melissa",
+}
+
+var lastNames = []string{
+	"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+	"Rodriguez", "Martinez", "Wilson", "Anderson", "Taylor", "Thomas", "Moore", "Jackson",
+	"Martin", "Lee", "White", "Harris", "Clark", "Lewis", "Fisher", "Price",
+}
+
+// syllables of the made up company names, Zoombox or Feedbug
+var syllables = []string{
+	"zoom", "box", "feed", "bug", "voo", "nix", "dab", "type", "thought", "beat",
+	"you", "lee", "xo", "mux", "o", "flash", "point", "sky", "ble", "jab",
+	"ber", "tag", "cat", "wiki", "blog", "buzz", "trunk", "yak", "quire", "rhyzio",
+}
+
+var countries = []string{
+	"Germany", "Ecuador", "Thailand", "Uruguay", "Dominican Republic", "Russia",
+	"China", "Brazil", "Indonesia", "France", "United States", "Japan", "Nigeria",
+	"Poland", "Canada", "Mexico", "Sweden", "Philippines", "Portugal", "Peru",
+	"Greece", "Czech Republic", "Ukraine", "Colombia",
+}
+
+var jobs = []string{
+	"Programmer Analyst", "Internal Auditor", "Automation Specialist", "Cost Accountant",
+	"Software Engineer", "Web Designer", "Financial Advisor", "Nurse", "Geologist",
+	"Sales Representative", "Account Executive", "Research Assistant", "Librarian",
+	"Help Desk Operator", "Office Assistant", "Paralegal", "Data Coordinator",
+}
+
+var domains = []string{"com", "net", "org", "gov", "edu", "info", "biz", "name", "mil"}
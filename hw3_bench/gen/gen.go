@@ -0,0 +1,212 @@
+// Package gen generates users in the format of data/users.txt. The output
+// only depends on the config, the same seed gives the same users
+package gen
+
+import (
+	"coursera-go/hw3_bench/fast"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/mailru/easyjson/jwriter"
+)
+
+// Browser is a user agent drawn with probability Weight/sum of all weights
+type Browser struct {
+	UA     string
+	Weight int
+}
+
+type Config struct {
+	Seed int64
+
+	// Browsers of the users, DefaultBrowsers if empty
+	Browsers []Browser
+
+	// BrowsersPerUser is the number of browsers of every user, 4 as in
+	// data/users.txt if 0
+	BrowsersPerUser int
+
+	// AndroidMSIE is the fraction of users with both an Android and an MSIE
+	// browser, the ones found by the default search. The others never have both
+	AndroidMSIE float64
+}
+
+type Generator struct {
+	rnd       *rand.Rand
+	n         int
+	fraction  float64
+	all       dist
+	android   dist
+	msie      dist
+	noAndroid dist
+	noMSIE    dist
+	w         jwriter.Writer
+	user      fast.User
+}
+
+func New(c Config) (*Generator, error) {
+	browsers := c.Browsers
+	if len(browsers) == 0 {
+		browsers = DefaultBrowsers
+	}
+
+	g := &Generator{
+		rnd:      rand.New(rand.NewSource(c.Seed)),
+		n:        c.BrowsersPerUser,
+		fraction: c.AndroidMSIE,
+	}
+	if g.n == 0 {
+		g.n = 4
+	}
+	if g.n < 0 {
+		return nil, fmt.Errorf("negative browsers per user %d", g.n)
+	}
+	if g.fraction < 0 || g.fraction > 1 {
+		return nil, fmt.Errorf("android and msie fraction %v not in [0, 1]", g.fraction)
+	}
+
+	for _, b := range browsers {
+		if b.Weight < 0 {
+			return nil, fmt.Errorf("negative weight of %q", b.UA)
+		}
+
+		android := strings.Contains(b.UA, "Android")
+		msie := strings.Contains(b.UA, "MSIE")
+
+		g.all.add(b)
+		if android {
+			g.android.add(b)
+		} else {
+			g.noAndroid.add(b)
+		}
+		if msie {
+			g.msie.add(b)
+		} else {
+			g.noMSIE.add(b)
+		}
+	}
+
+	if g.all.total() == 0 {
+		return nil, errors.New("no browsers to draw from")
+	}
+	if g.fraction > 0 && (g.n < 2 || g.android.total() == 0 || g.msie.total() == 0) {
+		return nil, errors.New("android and msie users need two browsers per user and both kinds of browsers")
+	}
+	if g.fraction < 1 && g.noAndroid.total() == 0 && g.noMSIE.total() == 0 {
+		return nil, errors.New("all the browsers are android and msie")
+	}
+
+	return g, nil
+}
+
+// User fills u with the next user, u.Browsers is reused
+func (g *Generator) User(u *fast.User) {
+	r := g.rnd
+	u.Browsers = u.Browsers[:0]
+
+	if r.Float64() < g.fraction {
+		u.Browsers = append(u.Browsers, g.android.draw(r), g.msie.draw(r))
+		for len(u.Browsers) < g.n {
+			u.Browsers = append(u.Browsers, g.all.draw(r))
+		}
+		r.Shuffle(len(u.Browsers), func(i, j int) {
+			u.Browsers[i], u.Browsers[j] = u.Browsers[j], u.Browsers[i]
+		})
+	} else {
+		d := &g.noAndroid
+		if d.total() == 0 || (g.noMSIE.total() > 0 && r.Intn(2) == 0) {
+			d = &g.noMSIE
+		}
+		for len(u.Browsers) < g.n {
+			u.Browsers = append(u.Browsers, d.draw(r))
+		}
+	}
+
+	first := firstNames[r.Intn(len(firstNames))]
+	last := lastNames[r.Intn(len(lastNames))]
+	u.Name = first + " " + last
+	u.Company = company(r)
+	u.Country = countries[r.Intn(len(countries))]
+	u.Job = jobs[r.Intn(len(jobs))]
+	u.Email = first + last + "@" + company(r) + "." + domains[r.Intn(len(domains))]
+	u.Phone = fmt.Sprintf("%03d-%02d-%02d", r.Intn(1000), r.Intn(100), r.Intn(100))
+}
+
+// Write writes n users as JSON lines, every line ends with a newline
+func (g *Generator) Write(w io.Writer, n int) error {
+	for i := 0; i < n; i++ {
+		g.User(&g.user)
+		g.user.MarshalEasyJSON(&g.w)
+		g.w.RawByte('\n')
+
+		if g.w.Size() >= 64<<10 || i == n-1 {
+			if _, err := g.w.DumpTo(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BrowsersFrom counts the browsers of the users in r, e.g. data/users.txt,
+// to generate users with the same distribution
+func BrowsersFrom(r io.Reader) ([]Browser, error) {
+	counts := map[string]int{}
+	err := (&fast.Searcher{}).Each(r, func(_ int, u *fast.User) error {
+		for _, b := range u.Browsers {
+			counts[strings.Clone(b)]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]Browser, 0, len(counts))
+	for ua, n := range counts {
+		rv = append(rv, Browser{ua, n})
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].Weight != rv[j].Weight {
+			return rv[i].Weight > rv[j].Weight
+		}
+		return rv[i].UA < rv[j].UA
+	})
+
+	return rv, nil
+}
+
+// dist draws browsers by cumulative weights
+type dist struct {
+	ua  []string
+	cum []int
+}
+
+func (d *dist) add(b Browser) {
+	if b.Weight == 0 {
+		return
+	}
+	d.ua = append(d.ua, b.UA)
+	d.cum = append(d.cum, d.total()+b.Weight)
+}
+
+func (d *dist) total() int {
+	if len(d.cum) == 0 {
+		return 0
+	}
+	return d.cum[len(d.cum)-1]
+}
+
+func (d *dist) draw(r *rand.Rand) string {
+	x := r.Intn(d.total())
+	return d.ua[sort.SearchInts(d.cum, x+1)]
+}
+
+func company(r *rand.Rand) string {
+	s := syllables[r.Intn(len(syllables))] + syllables[r.Intn(len(syllables))]
+	return strings.ToUpper(s[:1]) + s[1:]
+}
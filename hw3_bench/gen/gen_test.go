@@ -0,0 +1,167 @@
+package gen
+
+import (
+	"bytes"
+	"coursera-go/hw3_bench/fast"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func generate(t testing.TB, c Config, n int) []byte {
+	g, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := g.Write(out, n); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestSeed(t *testing.T) {
+	a := generate(t, Config{Seed: 1, AndroidMSIE: 0.1}, 1000)
+	b := generate(t, Config{Seed: 1, AndroidMSIE: 0.1}, 1000)
+	c := generate(t, Config{Seed: 2, AndroidMSIE: 0.1}, 1000)
+
+	if !bytes.Equal(a, b) {
+		t.Error("expected the same users for the same seed")
+	}
+	if bytes.Equal(a, c) {
+		t.Error("expected different users for different seeds")
+	}
+}
+
+func TestAndroidMSIE(t *testing.T) {
+	const n = 10000
+
+	for _, fraction := range []float64{0, 0.083, 0.5, 1} {
+		data := generate(t, Config{Seed: 42, AndroidMSIE: fraction}, n)
+
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if len(lines) != n {
+			t.Fatalf("expected %d lines, got %d", n, len(lines))
+		}
+
+		found := 0
+		for _, l := range lines {
+			u := fast.User{}
+			if err := json.Unmarshal([]byte(l), &u); err != nil {
+				t.Fatal(err)
+			}
+			if len(u.Browsers) != 4 || u.Name == "" || u.Company == "" || u.Country == "" ||
+				u.Job == "" || u.Phone == "" || !strings.Contains(u.Email, "@") {
+				t.Fatalf("incomplete user %s", l)
+			}
+
+			android, msie := false, false
+			for _, b := range u.Browsers {
+				android = android || strings.Contains(b, "Android")
+				msie = msie || strings.Contains(b, "MSIE")
+			}
+			if android && msie {
+				found++
+			}
+		}
+
+		got := float64(found) / n
+		if got < fraction-0.015 || got > fraction+0.015 {
+			t.Errorf("expected %v of the users with android and msie, got %v", fraction, got)
+		}
+	}
+}
+
+func TestBrowsers(t *testing.T) {
+	c := Config{
+		Seed:            7,
+		Browsers:        []Browser{{"Android MSIE", 1}, {"Android", 0}, {"Firefox", 3}},
+		BrowsersPerUser: 2,
+		AndroidMSIE:     0.5,
+	}
+	g, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	u := fast.User{}
+	for i := 0; i < 1000; i++ {
+		g.User(&u)
+		for _, b := range u.Browsers {
+			counts[b]++
+		}
+	}
+
+	if counts["Android"] != 0 {
+		t.Errorf("expected no browsers with weight 0, got %d", counts["Android"])
+	}
+	// half of the users have only "Android MSIE", the rest only "Firefox"
+	if counts["Android MSIE"] < 900 || counts["Firefox"] < 900 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	configs := map[string]Config{
+		"fraction":    {AndroidMSIE: 1.5},
+		"negative":    {BrowsersPerUser: -1},
+		"weight":      {Browsers: []Browser{{"Firefox", -1}}},
+		"empty":       {Browsers: []Browser{{"Firefox", 0}}},
+		"no msie":     {Browsers: []Browser{{"Android", 1}}, AndroidMSIE: 0.1},
+		"one":         {BrowsersPerUser: 1, AndroidMSIE: 0.1},
+		"always both": {Browsers: []Browser{{"Android MSIE", 1}}},
+	}
+
+	for name, c := range configs {
+		if _, err := New(c); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestBrowsersFrom(t *testing.T) {
+	f, err := os.Open("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	browsers, err := BrowsersFrom(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, b := range browsers {
+		total += b.Weight
+	}
+	if len(browsers) != 670 || total != 4000 {
+		t.Errorf("expected 670 browsers seen 4000 times, got %d and %d", len(browsers), total)
+	}
+	if browsers[0] != DefaultBrowsers[0] {
+		t.Errorf("expected %v first, got %v", DefaultBrowsers[0], browsers[0])
+	}
+
+	if _, err := New(Config{Browsers: browsers, AndroidMSIE: 0.1}); err != nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	g, err := New(Config{AndroidMSIE: 0.1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		if err := g.Write(out, 1000); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(int64(out.Len()))
+}
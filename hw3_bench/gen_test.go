@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"coursera-go/hw3_bench/fast"
+	"coursera-go/hw3_bench/gen"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func generated(tb testing.TB, users int) []byte {
+	g, err := gen.New(gen.Config{Seed: 1, AndroidMSIE: 0.083})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	if err := g.Write(out, users); err != nil {
+		tb.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestSearchGenerated(t *testing.T) {
+	data := generated(t, 20000)
+
+	slowOut := new(bytes.Buffer)
+	if err := slowSearch(bytes.NewReader(data), slowOut); err != nil {
+		t.Fatal(err)
+	}
+
+	fastOut := new(bytes.Buffer)
+	if err := fast.Search(bytes.NewReader(data), fastOut); err != nil {
+		t.Fatal(err)
+	}
+
+	parallelOut := new(bytes.Buffer)
+	if err := fast.SearchParallel(bytes.NewReader(data), parallelOut, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if slowOut.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fastOut, slowOut)
+	}
+	if slowOut.String() != parallelOut.String() {
+		t.Errorf("parallel results not match\nGot:\n%v\nExpected:\n%v", parallelOut, slowOut)
+	}
+}
+
+// go test -bench Generated -benchmem
+func BenchmarkSearchGenerated(b *testing.B) {
+	searches := []struct {
+		name   string
+		search func(r io.Reader, w io.Writer) error
+	}{
+		{"stream", fast.Search},
+		{"parallel", func(r io.Reader, w io.Writer) error { return fast.SearchParallel(r, w, 0) }},
+	}
+
+	for _, users := range []int{10000, 100000, 400000} {
+		data := generated(b, users)
+
+		for _, s := range searches {
+			b.Run(fmt.Sprintf("%s/%dk", s.name, users/1000), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := s.search(bytes.NewReader(data), io.Discard); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.SetBytes(int64(len(data)))
+			})
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"coursera-go/hw3_bench/fast"
+	"io"
+	"testing"
+)
+
+func TestSearchParallel(t *testing.T) {
+	slowOut := new(bytes.Buffer)
+	SlowSearch(slowOut)
+
+	fastOut := new(bytes.Buffer)
+	FastSearchParallel(fastOut)
+
+	if slowOut.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fastOut, slowOut)
+	}
+}
+
+func BenchmarkFastParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		FastSearchParallel(io.Discard)
+	}
+}
+
+func BenchmarkSearchParallel(b *testing.B) {
+	size := int64(256 << 20)
+	r := newRepeatReader(b, size)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r.reset(size)
+		err := fast.SearchParallel(r, io.Discard, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.SetBytes(size)
+}
@@ -0,0 +1,151 @@
+// Package report computes aggregates over the users in one pass and bounded
+// memory and writes them as text tables, CSV or JSON
+package report
+
+import (
+	"coursera-go/hw3_bench/fast"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Capacity is the number of counters kept for every reported row, the counts
+// are exact while the number of distinct keys fits into them
+var Capacity = 10
+
+type Report interface {
+	// Add counts the user, u is reused after the call
+	Add(u *fast.User)
+	Table() *Table
+}
+
+// Table rows hold strings, ints and float64 values
+type Table struct {
+	Title   string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Run feeds all the users of r matching s.Filter, or all of them when it is
+// nil, to the reports in a single pass
+func Run(s *fast.Searcher, r io.Reader, reports ...Report) error {
+	return s.Each(r, func(_ int, u *fast.User) error {
+		if s.Filter != nil && !s.Filter.Match(u, nil) {
+			return nil
+		}
+
+		for _, rep := range reports {
+			rep.Add(u)
+		}
+		return nil
+	})
+}
+
+func Write(w io.Writer, format string, tables ...*Table) error {
+	switch format {
+	case "text":
+		return writeText(w, tables)
+	case "csv":
+		return writeCSV(w, tables)
+	case "json":
+		return writeJSON(w, tables)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func writeText(w io.Writer, tables []*Table) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	for i, t := range tables {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw, t.Title)
+
+		for i, c := range t.Columns {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, c)
+		}
+		fmt.Fprintln(tw)
+
+		for _, row := range t.Rows {
+			for i, v := range row {
+				if i > 0 {
+					fmt.Fprint(tw, "\t")
+				}
+				fmt.Fprint(tw, cell(v))
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// writeCSV writes the tables one after another separated by an empty line,
+// the header row has the columns
+func writeCSV(w io.Writer, tables []*Table) error {
+	cw := csv.NewWriter(w)
+
+	for i, t := range tables {
+		if i > 0 {
+			cw.Flush()
+			fmt.Fprintln(w)
+		}
+
+		cw.Write(t.Columns)
+
+		rec := make([]string, len(t.Columns))
+		for _, row := range t.Rows {
+			for i, v := range row {
+				rec[i] = cell(v)
+			}
+			cw.Write(rec)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSON writes a list of tables with the rows as objects by column
+func writeJSON(w io.Writer, tables []*Table) error {
+	type table struct {
+		Title string                   `json:"title"`
+		Rows  []map[string]interface{} `json:"rows"`
+	}
+
+	out := []table{}
+	for _, t := range tables {
+		rows := []map[string]interface{}{}
+		for _, row := range t.Rows {
+			m := map[string]interface{}{}
+			for i, v := range row {
+				m[t.Columns[i]] = v
+			}
+			rows = append(rows, m)
+		}
+		out = append(out, table{t.Title, rows})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,308 @@
+package report
+
+import (
+	"bytes"
+	"coursera-go/hw3_bench/fast"
+	"coursera-go/hw3_bench/ua"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func users(t *testing.T) []*fast.User {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rv := []*fast.User{}
+	for _, line := range strings.Split(string(data), "\n") {
+		u := &fast.User{}
+		if err := json.Unmarshal([]byte(line), u); err != nil {
+			t.Fatal(err)
+		}
+		rv = append(rv, u)
+	}
+	return rv
+}
+
+func run(t *testing.T, reports ...Report) {
+	f, err := os.Open("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := Run(&fast.Searcher{}, f, reports...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTopKExact(t *testing.T) {
+	keys := strings.Fields("a b a c b a d a e b")
+	top := newTopK(10)
+	for _, k := range keys {
+		top.add(k)
+	}
+
+	got := top.top(3)
+	exp := []counter{{key: "a", count: 4}, {key: "b", count: 3}, {key: "c", count: 1}}
+	for i := range exp {
+		if got[i].key != exp[i].key || got[i].count != exp[i].count || got[i].err != 0 {
+			t.Errorf("%d: expected %+v, got %+v", i, exp[i], got[i])
+		}
+	}
+}
+
+func TestTopKBounds(t *testing.T) {
+	exact := map[string]int{}
+	top := newTopK(20)
+
+	for _, u := range users(t) {
+		exact[u.Company]++
+		top.add(u.Company)
+	}
+
+	if len(top.keys) != 20 || len(top.heap) != 20 {
+		t.Fatalf("expected 20 counters, got %d keys and %d in heap", len(top.keys), len(top.heap))
+	}
+
+	for _, c := range top.top(20) {
+		if n := exact[c.key]; n > c.count || n < c.count-c.err {
+			t.Errorf("%s: expected %d within [%d, %d]", c.key, n, c.count-c.err, c.count)
+		}
+	}
+}
+
+func TestReportsExact(t *testing.T) {
+	browsers := map[string]int{}
+	jobs := map[string]int{}
+	families := map[string]map[string]int{}
+	countries := map[string]int{}
+
+	for _, u := range users(t) {
+		seen := map[string]bool{}
+		fams := map[string]bool{}
+		for _, b := range u.Browsers {
+			if !seen[b] {
+				seen[b] = true
+				browsers[b]++
+			}
+			fams[ua.Parse(b).Family] = true
+		}
+
+		jobs[u.Job]++
+		countries[u.Country]++
+		if families[u.Country] == nil {
+			families[u.Country] = map[string]int{}
+		}
+		for f := range fams {
+			families[u.Country][f]++
+		}
+	}
+
+	// enough counters for every key so the counts are exact
+	defer func(c int) { Capacity = c }(Capacity)
+	Capacity = 1000
+
+	top := NewTopBrowsers(5)
+	share := NewFamilyShare(3, 2)
+	byJob, err := NewUsersBy("job", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, top, share, byJob)
+
+	check := func(tbl *Table, exact map[string]int) {
+		if len(tbl.Columns) != 2 {
+			t.Errorf("%s: expected no error column, got %v", tbl.Title, tbl.Columns)
+		}
+		if len(tbl.Rows) != 5 {
+			t.Fatalf("%s: expected 5 rows, got %d", tbl.Title, len(tbl.Rows))
+		}
+
+		prev := 1 << 30
+		for _, row := range tbl.Rows {
+			key, n := row[0].(string), row[1].(int)
+			if exact[key] != n {
+				t.Errorf("%s: %s expected %d, got %d", tbl.Title, key, exact[key], n)
+			}
+			if n > prev {
+				t.Errorf("%s: not sorted at %s", tbl.Title, key)
+			}
+			prev = n
+		}
+	}
+	check(top.Table(), browsers)
+	check(byJob.Table(), jobs)
+
+	tbl := share.Table()
+	if len(tbl.Rows) != 6 {
+		t.Fatalf("expected 6 rows, got %d", len(tbl.Rows))
+	}
+	for _, row := range tbl.Rows {
+		country, family, n := row[0].(string), row[1].(string), row[2].(int)
+		if families[country][family] != n {
+			t.Errorf("%s %s: expected %d, got %d", country, family, families[country][family], n)
+		}
+		if exp := float64(n) / float64(countries[country]) * 100; row[3].(float64)-exp > 0.05 || exp-row[3].(float64) > 0.05 {
+			t.Errorf("%s %s: expected share %.1f, got %v", country, family, exp, row[3])
+		}
+	}
+}
+
+func TestFamilyShareManyFamilies(t *testing.T) {
+	u := &fast.User{Country: "Nowhere"}
+	for i := 0; i < 20; i++ {
+		b := "Bot" + strconv.Itoa(i) + "/1.0"
+		u.Browsers = append(u.Browsers, b, b)
+	}
+
+	share := NewFamilyShare(1, 20)
+	share.Add(u)
+
+	tbl := share.Table()
+	if len(tbl.Rows) != 20 {
+		t.Fatalf("expected 20 rows, got %d", len(tbl.Rows))
+	}
+	for _, row := range tbl.Rows {
+		if row[2].(int) != 1 {
+			t.Errorf("%s: counted %d times", row[1], row[2])
+		}
+	}
+}
+
+func TestFamilyShareEvictEmpty(t *testing.T) {
+	defer func(c int) { Capacity = c }(Capacity)
+	Capacity = 1
+
+	// the country counter of the user without a country goes to the next one
+	share := NewFamilyShare(1, 1)
+	share.Add(&fast.User{Browsers: []string{"Bot/1.0"}})
+	share.Add(&fast.User{Country: "Nowhere", Browsers: []string{"Bot/1.0"}})
+
+	if _, ok := share.byCountry[""]; ok || len(share.byCountry) != 1 {
+		t.Errorf("expected only the new country, got %v", share.byCountry)
+	}
+}
+
+func TestUsersByUnknown(t *testing.T) {
+	if _, err := NewUsersBy("email", 5); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tables := []*Table{
+		{
+			Title:   "top browsers",
+			Columns: []string{"browser", "users"},
+			Rows:    [][]interface{}{{"Opera/9.80", 12}, {"Mozilla/5.0 (X11)", 3}},
+		},
+		{
+			Title:   "browser families by country",
+			Columns: []string{"country", "family", "users", "share"},
+			Rows:    [][]interface{}{{"Congo, \"DR\"", "IE", 2, 66.66}},
+		},
+	}
+
+	cases := []struct {
+		format string
+		exp    string
+	}{
+		{"text", `top browsers
+browser            users
+Opera/9.80         12
+Mozilla/5.0 (X11)  3
+
+browser families by country
+country      family  users  share
+Congo, "DR"  IE      2      66.7
+`},
+		{"csv", `browser,users
+Opera/9.80,12
+Mozilla/5.0 (X11),3
+
+country,family,users,share
+"Congo, ""DR""",IE,2,66.7
+`},
+		{"json", `[
+  {
+    "title": "top browsers",
+    "rows": [
+      {
+        "browser": "Opera/9.80",
+        "users": 12
+      },
+      {
+        "browser": "Mozilla/5.0 (X11)",
+        "users": 3
+      }
+    ]
+  },
+  {
+    "title": "browser families by country",
+    "rows": [
+      {
+        "country": "Congo, \"DR\"",
+        "family": "IE",
+        "share": 66.66,
+        "users": 2
+      }
+    ]
+  }
+]
+`},
+	}
+
+	for _, c := range cases {
+		out := new(bytes.Buffer)
+		if err := Write(out, c.format, tables...); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.exp {
+			t.Errorf("%s: expected\n%s\ngot\n%s", c.format, c.exp, out.String())
+		}
+	}
+
+	if err := Write(new(bytes.Buffer), "xml", tables...); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	exp := 0
+	for _, u := range users(t) {
+		for _, b := range u.Browsers {
+			if strings.Contains(b, "MSIE") {
+				exp++
+				break
+			}
+		}
+	}
+
+	byCountry, err := NewUsersBy("country", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := &fast.Searcher{Filter: fast.MustCompile(`browser~"MSIE"`)}
+	if err := Run(s, f, byCountry); err != nil {
+		t.Fatal(err)
+	}
+
+	got := 0
+	for _, row := range byCountry.Table().Rows {
+		got += row[1].(int)
+	}
+	if got != exp {
+		t.Errorf("expected %d users, got %d", exp, got)
+	}
+}
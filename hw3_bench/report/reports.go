@@ -0,0 +1,152 @@
+package report
+
+import (
+	"coursera-go/hw3_bench/fast"
+	"coursera-go/hw3_bench/ua"
+	"fmt"
+	"math"
+)
+
+// TopBrowsers counts users by browser, a user with the same browser twice is
+// counted once
+type TopBrowsers struct {
+	n   int
+	top *topK
+}
+
+func NewTopBrowsers(n int) *TopBrowsers {
+	return &TopBrowsers{n, newTopK(n * Capacity)}
+}
+
+func (r *TopBrowsers) Add(u *fast.User) {
+	for i, b := range u.Browsers {
+		if !seenBefore(u.Browsers[:i], b) {
+			r.top.add(b)
+		}
+	}
+}
+
+func (r *TopBrowsers) Table() *Table {
+	return counts("top browsers", "browser", r.top.top(r.n))
+}
+
+// UsersBy counts users by company, job or country
+type UsersBy struct {
+	field string
+	n     int
+	top   *topK
+}
+
+func NewUsersBy(field string, n int) (*UsersBy, error) {
+	if _, ok := byField[field]; !ok {
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+	return &UsersBy{field, n, newTopK(n * Capacity)}, nil
+}
+
+var byField = map[string]func(u *fast.User) string{
+	"company": func(u *fast.User) string { return u.Company },
+	"job":     func(u *fast.User) string { return u.Job },
+	"country": func(u *fast.User) string { return u.Country },
+}
+
+func (r *UsersBy) Add(u *fast.User) {
+	r.top.add(byField[r.field](u))
+}
+
+func (r *UsersBy) Table() *Table {
+	return counts("users by "+r.field, r.field, r.top.top(r.n))
+}
+
+// FamilyShare is the share of users per browser family in the top countries.
+// A user is counted once for every family among their browsers
+type FamilyShare struct {
+	countries int
+	families  int
+	top       *topK
+	byCountry map[string]*topK
+	seen      []string
+}
+
+func NewFamilyShare(countries, families int) *FamilyShare {
+	return &FamilyShare{
+		countries: countries,
+		families:  families,
+		top:       newTopK(countries * Capacity),
+		byCountry: map[string]*topK{},
+	}
+}
+
+func (r *FamilyShare) Add(u *fast.User) {
+	c, evicted, ok := r.top.add(u.Country)
+	if ok {
+		delete(r.byCountry, evicted)
+	}
+
+	fams := r.byCountry[c.key]
+	if fams == nil {
+		fams = newTopK(r.families * Capacity)
+		r.byCountry[c.key] = fams
+	}
+
+	r.seen = r.seen[:0]
+	for _, b := range u.Browsers {
+		f := ua.Parse(b).Family
+		if seenBefore(r.seen, f) {
+			continue
+		}
+		r.seen = append(r.seen, f)
+		fams.add(f)
+	}
+}
+
+// Table shares are in percent of the users counted since the country got its
+// counter, which is all of them unless there were too many countries
+func (r *FamilyShare) Table() *Table {
+	t := &Table{
+		Title:   "browser families by country",
+		Columns: []string{"country", "family", "users", "share"},
+	}
+
+	for _, c := range r.top.top(r.countries) {
+		users := c.count - c.err
+		for _, f := range r.byCountry[c.key].top(r.families) {
+			share := math.Round(float64(f.count)/float64(users)*1000) / 10
+			t.Rows = append(t.Rows, []interface{}{c.key, f.key, f.count, share})
+		}
+	}
+
+	return t
+}
+
+// counts has an error column only when some of the counts are estimates
+func counts(title, column string, top []counter) *Table {
+	t := &Table{Title: title, Columns: []string{column, "users"}}
+
+	estimated := false
+	for _, c := range top {
+		estimated = estimated || c.err > 0
+	}
+	if estimated {
+		t.Columns = append(t.Columns, "error")
+	}
+
+	for _, c := range top {
+		row := []interface{}{c.key, c.count}
+		if estimated {
+			row = append(row, c.err)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	return t
+}
+
+func seenBefore(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+)
+
+// topK counts the most frequent keys in bounded memory with the space saving
+// algorithm: when all the counters are taken the smallest one is given to the
+// new key. count is then an upper bound of the key frequency and count-err
+// is the exact number of adds since the key got its counter
+type topK struct {
+	cap  int
+	keys map[string]*counter
+	heap counters
+}
+
+type counter struct {
+	key   string
+	count int
+	err   int
+	i     int
+}
+
+func newTopK(capacity int) *topK {
+	return &topK{cap: max(capacity, 1), keys: map[string]*counter{}}
+}
+
+// add counts key and returns the key that lost its counter, ok is false when
+// no key did. key may point into a reused buffer, it is copied when stored
+func (t *topK) add(key string) (c *counter, evicted string, ok bool) {
+	if c, ok := t.keys[key]; ok {
+		c.count++
+		heap.Fix(&t.heap, c.i)
+		return c, "", false
+	}
+
+	if len(t.heap) < t.cap {
+		c := &counter{key: strings.Clone(key), count: 1}
+		t.keys[c.key] = c
+		heap.Push(&t.heap, c)
+		return c, "", false
+	}
+
+	c = t.heap[0]
+	evicted = c.key
+	delete(t.keys, evicted)
+
+	c.key = strings.Clone(key)
+	c.err = c.count
+	c.count++
+	t.keys[c.key] = c
+	heap.Fix(&t.heap, 0)
+
+	return c, evicted, true
+}
+
+// top returns up to n counters by count, ties by key
+func (t *topK) top(n int) []counter {
+	rv := make([]counter, 0, len(t.heap))
+	for _, c := range t.heap {
+		rv = append(rv, *c)
+	}
+
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].count != rv[j].count {
+			return rv[i].count > rv[j].count
+		}
+		return rv[i].key < rv[j].key
+	})
+
+	if len(rv) > n {
+		rv = rv[:n]
+	}
+	return rv
+}
+
+// counters is a min heap by count
+type counters []*counter
+
+func (h counters) Len() int           { return len(h) }
+func (h counters) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h counters) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].i = i
+	h[j].i = j
+}
+
+func (h *counters) Push(x interface{}) {
+	c := x.(*counter)
+	c.i = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *counters) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,468 @@
+// Package server answers searches over a users file through HTTP. The file
+// is indexed at the start and loaded again when it changes
+package server
+
+import (
+	"bytes"
+	"coursera-go/hw3_bench/fast"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Config struct {
+	// Path of the users file, compressed files are searched without an index
+	Path string
+	// Index is where the index is saved, Path+".idx" if empty
+	Index string
+
+	// Reload is how often the file is checked for changes, a second if zero,
+	// never if negative
+	Reload time.Duration
+
+	// Redact and Salt apply to all the responses, as in fast.Searcher
+	Redact map[string]fast.Policy
+	Salt   string
+}
+
+// Stats are about the whole file, Unique has the number of the unique
+// browsers by every key of fast.Searcher.Unique
+type Stats struct {
+	Users    int            `json:"users"`
+	Browsers int            `json:"browsers"`
+	Unique   map[string]int `json:"unique"`
+	Loaded   time.Time      `json:"loaded"`
+}
+
+var uniqueKeys = []string{"family", "version", "os", "device"}
+
+// Server is an http.Handler with /search and /stats
+type Server struct {
+	c   Config
+	mux *http.ServeMux
+
+	// ix is never changed, only swapped for a fresh one. Every search
+	// refreshes its own copy, so searches run at once. ix is nil for a
+	// compressed file
+	ix atomic.Pointer[fast.Index]
+
+	// smu guards the stats and the version of the file they are for
+	smu     sync.RWMutex
+	stats   Stats
+	size    int64
+	modTime time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func New(c Config) (*Server, error) {
+	if c.Reload == 0 {
+		c.Reload = time.Second
+	}
+
+	// the options are checked without a search
+	if _, err := (&fast.Searcher{Redact: c.Redact, Salt: c.Salt}).CountUnique(nil); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		c:    c,
+		mux:  http.NewServeMux(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	s.mux.HandleFunc("/search", s.search)
+	s.mux.HandleFunc("/stats", s.statsHandler)
+
+	ix, err := fast.OpenIndex(c.Path, c.Index)
+	if err != nil && !errors.Is(err, fast.ErrCompressed) {
+		return nil, err
+	}
+	s.ix.Store(ix)
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if c.Reload > 0 {
+		go s.watch()
+	} else {
+		close(s.done)
+	}
+
+	return s, nil
+}
+
+// Close stops watching the file
+func (s *Server) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	return nil
+}
+
+func (s *Server) watch() {
+	defer close(s.done)
+
+	t := time.NewTicker(s.c.Reload)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+		}
+
+		if err := s.Reload(); err != nil {
+			log.Println("reload:", err)
+		}
+	}
+}
+
+// Reload builds the index and the stats again if the size or the
+// modification time of the file changed. Searches through the index also
+// check the contents, so they never use an old index
+func (s *Server) Reload() error {
+	fi, err := os.Stat(s.c.Path)
+	if err != nil {
+		return err
+	}
+
+	s.smu.RLock()
+	same := fi.Size() == s.size && fi.ModTime().Equal(s.modTime)
+	s.smu.RUnlock()
+	if same {
+		return nil
+	}
+
+	if ix := s.ix.Load(); ix != nil {
+		fresh := *ix
+		if err := fresh.Refresh(); err != nil {
+			return err
+		}
+		s.ix.CompareAndSwap(ix, &fresh)
+	}
+
+	return s.load()
+}
+
+// load reads the stats of the whole file, the version of the file is taken
+// first so a change while reading is loaded again
+func (s *Server) load() error {
+	fi, err := os.Stat(s.c.Path)
+	if err != nil {
+		return err
+	}
+
+	f, err := fast.Open(s.c.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	st := Stats{Unique: map[string]int{}, Loaded: time.Now()}
+	browsers := map[string]bool{}
+	err = (&fast.Searcher{}).Each(f, func(line int, u *fast.User) error {
+		st.Users++
+		for _, b := range u.Browsers {
+			// b is valid only in fn
+			if !browsers[b] {
+				browsers[strings.Clone(b)] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	st.Browsers = len(browsers)
+	for _, key := range uniqueKeys {
+		st.Unique[key], _ = (&fast.Searcher{Unique: key}).CountUnique(browsers)
+	}
+
+	s.smu.Lock()
+	s.stats, s.size, s.modTime = st, fi.Size(), fi.ModTime()
+	s.smu.Unlock()
+
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeResponse(w, http.StatusMethodNotAllowed, nil, "method not allowed")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// run searches through the index or streams the file. A copy of the index
+// refreshed by the search takes the place of the shared one
+func (s *Server) run(sr *fast.Searcher, w io.Writer) error {
+	if ix := s.ix.Load(); ix != nil {
+		c := *ix
+		if err := sr.SearchIndex(&c, w); err != nil {
+			return err
+		}
+		s.ix.CompareAndSwap(ix, &c)
+		return nil
+	}
+
+	f, err := fast.Open(s.c.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return sr.Search(f, w)
+}
+
+// searcher makes the searcher of expr and unique of the query, the default
+// filter for an empty expr
+func (s *Server) searcher(r *http.Request) (*fast.Searcher, error) {
+	q := r.URL.Query()
+	sr := &fast.Searcher{Unique: q.Get("unique"), Redact: s.c.Redact, Salt: s.c.Salt}
+
+	if expr := q.Get("expr"); expr != "" {
+		f, err := fast.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		sr.Filter = f
+	}
+
+	if _, err := sr.CountUnique(nil); err != nil {
+		return nil, err
+	}
+
+	return sr, nil
+}
+
+// formats are the search formats and the formats of fast.Searcher
+var formats = map[string]string{"": "", "text": "", "json": "jsonl", "csv": "csv"}
+
+// SearchResult is the response of /search?format=json
+type SearchResult struct {
+	Total  int               `json:"total"`
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+	Unique int               `json:"unique_browsers"`
+	Users  []json.RawMessage `json:"users"`
+}
+
+// search answers with the output of fast.Searcher, offset and limit select
+// the found users, limit 0 is all of them. The text output of the default
+// query is the output of SlowSearch
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	sr, err := s.searcher(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, nil, err.Error())
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	f, ok := formats[format]
+	if !ok {
+		writeResponse(w, http.StatusBadRequest, nil, fmt.Sprintf("unknown format %q", format))
+		return
+	}
+	sr.Format = f
+
+	offset, err := intParam(r, "offset")
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, nil, err.Error())
+		return
+	}
+	limit, err := intParam(r, "limit")
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, nil, err.Error())
+		return
+	}
+
+	// the csv header, "found users:" and the text footer with an empty line
+	// before it are kept around the page
+	p := &pager{offset: offset, limit: limit}
+	switch format {
+	case "csv":
+		p.head = 1
+	case "", "text":
+		p.head, p.foot = 1, 2
+	}
+
+	sum := fast.Summary{}
+	sr.Summary = &sum
+	if err := s.run(sr, p); err != nil {
+		writeResponse(w, http.StatusInternalServerError, nil, err.Error())
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(sum.Users))
+
+	switch format {
+	case "json":
+		res := SearchResult{Total: sum.Users, Offset: offset, Limit: limit, Unique: sum.Unique}
+		for _, l := range p.page() {
+			res.Users = append(res.Users, bytes.TrimSuffix(l, []byte{'\n'}))
+		}
+		if res.Users == nil {
+			res.Users = []json.RawMessage{}
+		}
+		writeResponse(w, http.StatusOK, res, "")
+
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		for _, l := range p.page() {
+			w.Write(l)
+		}
+
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, l := range p.page() {
+			w.Write(l)
+		}
+	}
+}
+
+func intParam(r *http.Request, name string) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad %s %q", name, v)
+	}
+	return n, nil
+}
+
+// pager is written the output of a search. It keeps head lines at the start,
+// foot lines at the end and the lines between them selected by offset and
+// limit, limit 0 is all of them. The other lines are dropped as they come
+type pager struct {
+	head, foot    int
+	offset, limit int
+
+	n     int
+	line  []byte
+	lines [][]byte
+	// tail has the last foot lines, which may turn out to be users
+	tail [][]byte
+}
+
+func (p *pager) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n') + 1
+		if i == 0 {
+			p.line = append(p.line, b...)
+			break
+		}
+		p.line = append(p.line, b[:i]...)
+		p.add()
+		b = b[i:]
+	}
+	return n, nil
+}
+
+// add takes the complete line, the buffer is reused unless the line is kept
+func (p *pager) add() {
+	l := p.line
+	p.line = p.line[:0]
+	if p.n < p.head {
+		p.lines = append(p.lines, bytes.Clone(l))
+		p.n++
+		return
+	}
+
+	// the lines in tail are copies already
+	if p.foot > 0 {
+		p.tail = append(p.tail, bytes.Clone(l))
+		if len(p.tail) <= p.foot {
+			return
+		}
+		l = p.tail[0]
+		p.tail = append(p.tail[:0], p.tail[1:]...)
+	}
+
+	i := p.n - p.head
+	p.n++
+	if i < p.offset || p.limit > 0 && i >= p.offset+p.limit {
+		return
+	}
+	if p.foot == 0 {
+		l = bytes.Clone(l)
+	}
+	p.lines = append(p.lines, l)
+}
+
+// page returns the kept lines, the last one may have no newline
+func (p *pager) page() [][]byte {
+	if len(p.line) > 0 {
+		p.add()
+	}
+	return append(p.lines, p.tail...)
+}
+
+// MatchStats are the stats of the users found by the expr of /stats
+type MatchStats struct {
+	Users  int `json:"users"`
+	Unique int `json:"unique_browsers"`
+}
+
+// statsHandler answers with the stats of the file, and of the found users
+// when there is an expr
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	s.smu.RLock()
+	st := s.stats
+	s.smu.RUnlock()
+
+	if r.URL.Query().Get("expr") == "" && r.URL.Query().Get("unique") == "" {
+		writeResponse(w, http.StatusOK, st, "")
+		return
+	}
+
+	sr, err := s.searcher(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, nil, err.Error())
+		return
+	}
+
+	sum := fast.Summary{}
+	sr.Format, sr.Summary = "jsonl", &sum
+	if err := s.run(sr, new(bytes.Buffer)); err != nil {
+		writeResponse(w, http.StatusInternalServerError, nil, err.Error())
+		return
+	}
+
+	writeResponse(w, http.StatusOK, struct {
+		Stats
+		Match MatchStats `json:"match"`
+	}{st, MatchStats{sum.Users, sum.Unique}}, "")
+}
+
+func writeResponse(w http.ResponseWriter, status int, data interface{}, err string) {
+	resp := struct {
+		Error string      `json:"error,omitempty"`
+		Data  interface{} `json:"response,omitempty"`
+	}{err, data}
+
+	js, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
@@ -0,0 +1,312 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"coursera-go/hw3_bench/fast"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func usersFile(t *testing.T) string {
+	data, err := os.ReadFile("../data/users.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newServer(t *testing.T, c Config) *Server {
+	s, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func get(t *testing.T, s *Server, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return w
+}
+
+func searchJSON(t *testing.T, s *Server, query string) SearchResult {
+	w := get(t, s, "/search?format=json&"+query)
+	if w.Code != 200 {
+		t.Fatalf("%s: status %d: %s", query, w.Code, w.Body)
+	}
+
+	resp := struct {
+		Response SearchResult `json:"response"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Response
+}
+
+func stats(t *testing.T, s *Server, query string) map[string]interface{} {
+	w := get(t, s, "/stats?"+query)
+	if w.Code != 200 {
+		t.Fatalf("%s: status %d: %s", query, w.Code, w.Body)
+	}
+
+	resp := struct {
+		Response map[string]interface{} `json:"response"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Response
+}
+
+func TestSearchPages(t *testing.T) {
+	s := newServer(t, Config{Path: usersFile(t), Reload: -1})
+
+	all := searchJSON(t, s, "")
+	if all.Total == 0 || len(all.Users) != all.Total || all.Unique == 0 {
+		t.Fatalf("bad result: %+v", all)
+	}
+
+	for _, c := range []struct {
+		offset, limit int
+	}{
+		{0, 1},
+		{1, 2},
+		{all.Total - 1, 5},
+		{all.Total, 1},
+		{all.Total + 10, 0},
+	} {
+		res := searchJSON(t, s, "offset="+strconv.Itoa(c.offset)+"&limit="+strconv.Itoa(c.limit))
+		exp := all.Users[min(c.offset, all.Total):]
+		if c.limit > 0 && c.limit < len(exp) {
+			exp = exp[:c.limit]
+		}
+
+		if res.Total != all.Total || res.Unique != all.Unique {
+			t.Errorf("%+v: got total %d unique %d", c, res.Total, res.Unique)
+		}
+		if len(res.Users) != len(exp) {
+			t.Errorf("%+v: got %d users, expected %d", c, len(res.Users), len(exp))
+			continue
+		}
+		for i := range exp {
+			if !bytes.Equal(res.Users[i], exp[i]) {
+				t.Errorf("%+v: user %d is %s, expected %s", c, i, res.Users[i], exp[i])
+			}
+		}
+	}
+
+	text := get(t, s, "/search?offset=1&limit=2").Body.String()
+	lines := strings.Split(text, "\n")
+	if len(lines) != 6 || lines[0] != "found users:" || lines[3] != "" ||
+		lines[4] != "Total unique browsers "+strconv.Itoa(all.Unique) {
+		t.Errorf("bad text page:\n%s", text)
+	}
+
+	csv := get(t, s, "/search?format=csv&limit=1")
+	if got := strings.Count(csv.Body.String(), "\n"); got != 2 {
+		t.Errorf("csv page has %d lines:\n%s", got, csv.Body)
+	}
+	if got := csv.Header().Get("X-Total-Count"); got != strconv.Itoa(all.Total) {
+		t.Errorf("X-Total-Count is %q, expected %d", got, all.Total)
+	}
+}
+
+func TestPager(t *testing.T) {
+	out := "head\nu0\nu1\nu2\nu3\n\nfoot"
+
+	for _, c := range []struct {
+		head, foot, offset, limit int
+		exp                       string
+	}{
+		{1, 2, 1, 2, "head\nu1\nu2\n\nfoot"},
+		{1, 2, 0, 0, out},
+		{1, 2, 10, 1, "head\n\nfoot"},
+		{0, 0, 3, 0, "u2\nu3\n\nfoot"},
+		{1, 0, 0, 1, "head\nu0\n"},
+	} {
+		// the output comes in pieces not ending at the newlines
+		p := &pager{head: c.head, foot: c.foot, offset: c.offset, limit: c.limit}
+		for b := []byte(out); len(b) > 0; b = b[min(3, len(b)):] {
+			p.Write(b[:min(3, len(b))])
+		}
+
+		if got := string(bytes.Join(p.page(), nil)); got != c.exp {
+			t.Errorf("%+v: got %q, expected %q", c, got, c.exp)
+		}
+	}
+}
+
+func TestSearchConcurrent(t *testing.T) {
+	path := usersFile(t)
+	s := newServer(t, Config{Path: path, Reload: -1})
+	exp := searchJSON(t, s, "")
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// the searches refresh their copies of the index while the file grows
+	done := make(chan *httptest.ResponseRecorder)
+	for i := 0; i < 4; i++ {
+		go func() {
+			done <- get(t, s, "/search?format=json")
+		}()
+	}
+	f.WriteString("\n" + `{"browsers":["Android 4.4","MSIE 10.0"],"name":"New User","email":"new@user.org"}`)
+	for i := 0; i < 4; i++ {
+		w := <-done
+		total, _ := strconv.Atoi(w.Header().Get("X-Total-Count"))
+		if w.Code != 200 || total != exp.Total && total != exp.Total+1 {
+			t.Errorf("status %d, got %d users, expected %d or %d", w.Code, total, exp.Total, exp.Total+1)
+		}
+	}
+
+	if res := searchJSON(t, s, ""); res.Total != exp.Total+1 {
+		t.Errorf("got %d users after the append, expected %d", res.Total, exp.Total+1)
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	s := newServer(t, Config{
+		Path:   usersFile(t),
+		Reload: -1,
+		Redact: map[string]fast.Policy{"email": fast.Mask},
+	})
+
+	expr := "expr=" + url.QueryEscape(`browser~"Android" && browser~"Opera"`)
+	raw := searchJSON(t, s, expr)
+	res := searchJSON(t, s, expr+"&unique=family")
+	if res.Total == 0 || res.Total != raw.Total {
+		t.Fatalf("found %d users, %d counting families", raw.Total, res.Total)
+	}
+	for _, u := range res.Users {
+		if !bytes.Contains(u, []byte(`*`)) {
+			t.Errorf("email is not masked: %s", u)
+		}
+	}
+	if res.Unique == 0 || res.Unique >= raw.Unique {
+		t.Errorf("got %d unique families of %d browsers", res.Unique, raw.Unique)
+	}
+
+	for _, target := range []string{
+		"/search?expr=" + url.QueryEscape(`browser~`),
+		"/search?format=xml",
+		"/search?offset=-1",
+		"/search?limit=x",
+		"/search?unique=planet",
+		"/stats?expr=" + url.QueryEscape(`(`),
+	} {
+		if w := get(t, s, target); w.Code != 400 {
+			t.Errorf("%s: status %d, expected 400", target, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", "/search", nil))
+	if w.Code != 405 {
+		t.Errorf("POST: status %d, expected 405", w.Code)
+	}
+
+	if _, err := New(Config{Path: usersFile(t), Redact: map[string]fast.Policy{"name": fast.Hash}}); err == nil {
+		t.Error("expected error for hash without a salt")
+	}
+}
+
+func TestStats(t *testing.T) {
+	path := usersFile(t)
+	s := newServer(t, Config{Path: path, Reload: -1})
+
+	data, _ := os.ReadFile(path)
+	st := stats(t, s, "")
+	if st["users"] != float64(bytes.Count(data, []byte{'\n'})+1) {
+		t.Errorf("got %v users", st["users"])
+	}
+
+	unique := st["unique"].(map[string]interface{})
+	for _, key := range uniqueKeys {
+		n, _ := unique[key].(float64)
+		if n == 0 || n > st["browsers"].(float64) {
+			t.Errorf("%s: %v unique of %v browsers", key, unique[key], st["browsers"])
+		}
+	}
+
+	res := searchJSON(t, s, "")
+	match := stats(t, s, "expr="+url.QueryEscape(`browser~"Android" && browser~"MSIE"`))["match"].(map[string]interface{})
+	if match["users"] != float64(res.Total) || match["unique_browsers"] != float64(res.Unique) {
+		t.Errorf("got match %v, expected %d users and %d unique", match, res.Total, res.Unique)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := usersFile(t)
+	s := newServer(t, Config{Path: path, Reload: 10 * time.Millisecond})
+
+	before := searchJSON(t, s, "")
+	users := stats(t, s, "")["users"]
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("\n" + `{"browsers":["Android 4.4","MSIE 10.0","Reloaded/1.0"],"name":"New User","email":"new@user.org"}`)
+	f.Close()
+
+	// the search checks the index itself
+	after := searchJSON(t, s, "")
+	if after.Total != before.Total+1 || after.Unique != before.Unique+2 {
+		t.Errorf("after append: got %d users %d unique, before %d and %d",
+			after.Total, after.Unique, before.Total, before.Unique)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if got := stats(t, s, "")["users"]; got == users.(float64)+1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stats were not reloaded")
+		}
+	}
+}
+
+func TestSearchCompressed(t *testing.T) {
+	path := usersFile(t)
+	data, _ := os.ReadFile(path)
+
+	gz := new(bytes.Buffer)
+	zw := gzip.NewWriter(gz)
+	zw.Write(data)
+	zw.Close()
+	if err := os.WriteFile(path+".gz", gz.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := newServer(t, Config{Path: path, Reload: -1})
+	compressed := newServer(t, Config{Path: path + ".gz", Reload: -1})
+	if compressed.ix.Load() != nil {
+		t.Error("compressed file is indexed")
+	}
+
+	for _, target := range []string{"/search", "/search?format=csv&offset=3&limit=4"} {
+		exp, got := get(t, plain, target).Body.String(), get(t, compressed, target).Body.String()
+		if got != exp {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", target, got, exp)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"coursera-go/hw3_bench/server"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchServer(t *testing.T) {
+	exp := new(bytes.Buffer)
+	if err := SlowSearch(exp); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := server.New(server.Config{
+		Path:   filePath,
+		Index:  filepath.Join(t.TempDir(), "users.idx"),
+		Reload: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, url := range []string{"/search", "/search?format=text", "/search?offset=0&limit=0"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+		if w.Code != 200 {
+			t.Errorf("%s: status %d: %s", url, w.Code, w.Body)
+		}
+		if w.Body.String() != exp.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", url, w.Body, exp)
+		}
+	}
+}
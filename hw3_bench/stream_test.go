@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"coursera-go/hw3_bench/fast"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+var bigSize = flag.Int64("bigsize", 0, "extra input size in bytes for BenchmarkSearchStream, e.g. 4294967296")
+
+// repeatReader repeats the sample users until at least size bytes were read
+type repeatReader struct {
+	data []byte
+	off  int
+	left int
+}
+
+func newRepeatReader(tb testing.TB, size int64) *repeatReader {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	data = append(data, '\n')
+
+	r := &repeatReader{data: data}
+	r.reset(size)
+
+	return r
+}
+
+func (r *repeatReader) reset(size int64) {
+	r.off = 0
+	r.left = int((size + int64(len(r.data)) - 1) / int64(len(r.data)))
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.data[r.off:])
+	r.off += n
+	if r.off == len(r.data) {
+		r.off = 0
+		r.left--
+	}
+
+	return n, nil
+}
+
+func TestSearchStream(t *testing.T) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	long := fmt.Sprintf(`{"browsers":["%s Android %s","MSIE %s"],"email":"long@line.org","name":"Long Line"}`,
+		strings.Repeat("x", 100000), strings.Repeat("y", 100000), strings.Repeat("z", 70000))
+
+	tests := map[string]string{
+		"sample":   string(data),
+		"repeated": string(data) + "\n" + string(data),
+		"long":     string(data) + "\n" + long + "\n" + string(data),
+		"newline":  string(data) + "\n",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			slowOut := new(bytes.Buffer)
+			slowSearch(strings.NewReader(input), slowOut)
+
+			fastOut := new(bytes.Buffer)
+			err := fast.Search(strings.NewReader(input), fastOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if slowOut.String() != fastOut.String() {
+				t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fastOut, slowOut)
+			}
+		})
+	}
+}
+
+// B/op should stay the same for every size
+func BenchmarkSearchStream(b *testing.B) {
+	sizes := []int64{1 << 20, 16 << 20, 256 << 20}
+	if *bigSize > 0 {
+		sizes = append(sizes, *bigSize)
+	}
+
+	for _, size := range sizes {
+		b.Run(fmt.Sprintf("%dMB", size>>20), func(b *testing.B) {
+			r := newRepeatReader(b, size)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				r.reset(size)
+				err := fast.Search(r, io.Discard)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.SetBytes(size)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Package ua parses user agent strings like the ones in data/users.txt into
+// browser family, version, OS and device type. Parse does not allocate, the
+// returned strings are constants or substrings of the input
+package ua
+
+import "strings"
+
+const (
+	Desktop = "Desktop"
+	Mobile  = "Mobile"
+	Tablet  = "Tablet"
+	Bot     = "Bot"
+)
+
+type UA struct {
+	Family  string
+	Version Version
+
+	OS        string
+	OSVersion Version
+
+	Device string
+}
+
+// rules are tried in order, the version follows the token
+var rules = []struct {
+	family string
+	token  string
+}{
+	{"Edge", "Edge/"},
+	{"Opera", "OPR/"},
+	{"Opera Mini", "Opera Mini/"},
+	{"IE Mobile", "IEMobile/"},
+	{"IE Mobile", "IEMobile "},
+	{"UC Browser", "UCBrowser/"},
+	{"Puffin", "Puffin/"},
+	{"Silk", "Silk/"},
+	{"Beamrise", "Beamrise/"},
+	{"SeaMonkey", "SeaMonkey/"},
+	{"Epiphany", "Epiphany/"},
+	{"Arora", "Arora/"},
+	{"OmniWeb", "OmniWeb/v"},
+	{"Konqueror", "Konqueror/"},
+	{"Midori", "Midori/"},
+	{"Kindle", "Kindle/"},
+	{"Firefox Mobile", "Fennec/"},
+	{"Chrome", "CriOS/"},
+	{"Chrome", "Chrome/"},
+	{"Firefox", "FxiOS/"},
+	{"Firefox", "Firefox/"},
+}
+
+var bots = []string{"bot", "crawl", "spider", "slurp", "mediapartners", "feedfetcher", "facebookexternalhit"}
+
+var mobiles = []string{"Mobi", "iPhone", "iPod", "Windows Phone", "Windows CE", "IEMobile", "Symbian", "SymbOS",
+	"Series60", "MIDP", "BlackBerry", "Opera Mini", "Fennec", "J2ME"}
+
+var tablets = []string{"iPad", "Tablet", "Kindle", "Silk/"}
+
+func Parse(s string) UA {
+	a := UA{}
+	a.Family, a.Version = family(s)
+	a.OS, a.OSVersion = system(s)
+	a.Device = device(s, a.OS)
+	return a
+}
+
+func family(s string) (string, Version) {
+	for _, r := range rules {
+		if strings.Contains(s, r.token) {
+			return r.family, after(s, r.token)
+		}
+	}
+
+	// Opera sometimes pretends to be IE and has the real version in Version/
+	if strings.HasPrefix(s, "Opera/") || strings.Contains(s, "Opera ") {
+		switch {
+		case strings.Contains(s, "Version/"):
+			return "Opera", after(s, "Version/")
+		case strings.HasPrefix(s, "Opera/"):
+			return "Opera", after(s, "Opera/")
+		}
+		return "Opera", after(s, "Opera ")
+	}
+
+	switch {
+	case strings.Contains(s, "MSIE "):
+		return "IE", after(s, "MSIE ")
+	case strings.Contains(s, "Trident/") && strings.Contains(s, "rv:"):
+		return "IE", after(s, "rv:")
+	case strings.Contains(s, "Android") && containsFold(s, "applewebkit"):
+		return "Android", after(s, "Android ")
+	case strings.Contains(s, "Safari/") || strings.Contains(s, "AppleWebKit/") && strings.Contains(s, "Mobile/"):
+		return "Safari", after(s, "Version/")
+	case strings.HasPrefix(s, "Mozilla/") && strings.Contains(s, "Gecko") && strings.Contains(s, "rv:"):
+		return "Mozilla", after(s, "rv:")
+	case strings.HasPrefix(s, "Mozilla/"):
+		return "Other", Version{}
+	}
+
+	// product/version or product version
+	end := strings.IndexAny(s, "/ ;(")
+	if end < 0 {
+		return s, Version{}
+	}
+	return s[:end], ParseVersion(s[end+1:])
+}
+
+func system(s string) (string, Version) {
+	switch {
+	case strings.Contains(s, "Windows Phone"):
+		if strings.Contains(s, "Windows Phone OS ") {
+			return "Windows Phone", after(s, "Windows Phone OS ")
+		}
+		return "Windows Phone", after(s, "Windows Phone ")
+	case strings.Contains(s, "Windows CE"):
+		return "Windows CE", Version{}
+	case strings.Contains(s, "Windows NT "):
+		return "Windows", after(s, "Windows NT ")
+	case strings.Contains(s, "Windows XP"):
+		return "Windows", Version{5, 1, 0}
+	case strings.Contains(s, "Windows") || strings.Contains(s, "Win9") || strings.Contains(s, "Win 9"):
+		return "Windows", Version{}
+	case strings.Contains(s, "Android"):
+		return "Android", after(s, "Android ")
+	case strings.Contains(s, "iPhone") || strings.Contains(s, "iPad") || strings.Contains(s, "iPod"):
+		if strings.Contains(s, "iPhone OS ") {
+			return "iOS", after(s, "iPhone OS ")
+		}
+		return "iOS", after(s, "CPU OS ")
+	case strings.Contains(s, "CrOS"):
+		return "Chrome OS", Version{}
+	case strings.Contains(s, "Mac OS X"):
+		return "Mac OS X", after(s, "Mac OS X ")
+	case strings.Contains(s, "Macintosh") || strings.Contains(s, "Mac_PowerPC"):
+		return "Mac OS", Version{}
+	case strings.Contains(s, "Symbian") || strings.Contains(s, "SymbOS") || strings.Contains(s, "Series60") || strings.Contains(s, "S60;"):
+		return "Symbian", Version{}
+	case strings.Contains(s, "BlackBerry"):
+		return "BlackBerry", Version{}
+	}
+
+	for _, name := range []string{"FreeBSD", "NetBSD", "OpenBSD", "DragonFly", "OS/2", "BeOS"} {
+		if strings.Contains(s, name) {
+			return name, Version{}
+		}
+	}
+
+	switch {
+	case strings.Contains(s, "Linux") || strings.Contains(s, "X11") || strings.Contains(s, "Ubuntu"):
+		return "Linux", Version{}
+	case strings.Contains(s, "PalmOS") || strings.Contains(s, "PalmSource"):
+		return "Palm OS", Version{}
+	}
+
+	return "Other", Version{}
+}
+
+func device(s, os string) string {
+	for _, b := range bots {
+		if containsFold(s, b) {
+			return Bot
+		}
+	}
+
+	for _, t := range tablets {
+		if strings.Contains(s, t) {
+			return Tablet
+		}
+	}
+
+	for _, m := range mobiles {
+		if strings.Contains(s, m) {
+			return Mobile
+		}
+	}
+
+	// Android without Mobile is a tablet by convention
+	if os == "Android" {
+		return Tablet
+	}
+
+	return Desktop
+}
+
+func after(s, token string) Version {
+	i := strings.Index(s, token)
+	if i < 0 {
+		return Version{}
+	}
+	return ParseVersion(s[i+len(token):])
+}
+
+// containsFold reports whether s contains the lower case ASCII sub ignoring
+// case, strings.ToLower would allocate
+func containsFold(s, sub string) bool {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		j := 0
+		for ; j < len(sub); j++ {
+			c := s[i+j]
+			if c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != sub[j] {
+				break
+			}
+		}
+		if j == len(sub) {
+			return true
+		}
+	}
+	return false
+}
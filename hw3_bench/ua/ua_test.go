@@ -0,0 +1,136 @@
+package ua
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ua  string
+		exp UA
+	}{
+		{
+			"Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 5.1; Trident/4.0; .NET CLR 2.0.50727)",
+			UA{"IE", Version{8, 0, 0}, "Windows", Version{5, 1, 0}, Desktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 6.3; Trident/7.0; rv:11.0) like Gecko",
+			UA{"IE", Version{11, 0, 0}, "Windows", Version{6, 3, 0}, Desktop},
+		},
+		{
+			"Mozilla/5.0 (compatible; MSIE 9.0; Windows Phone OS 7.5; Trident/5.0; IEMobile/9.0)",
+			UA{"IE Mobile", Version{9, 0, 0}, "Windows Phone", Version{7, 5, 0}, Mobile},
+		},
+		{
+			"Mozilla/5.0 (MSIE 9.0; Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.79 Safari/537.36 Edge/14.14931",
+			UA{"Edge", Version{14, 14931, 0}, "Windows", Version{10, 0, 0}, Desktop},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 6.0.1; SM-G900H Build/MMB29K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/52.0.2743.98 Mobile Safari/537.36",
+			UA{"Chrome", Version{52, 0, 2743}, "Android", Version{6, 0, 1}, Mobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; U; Android 2.2; en-us; Nexus One Build/FRF91) AppleWebKit/533.1 (KHTML, like Gecko) Version/4.0 Mobile Safari/533.1",
+			UA{"Android", Version{2, 2, 0}, "Android", Version{2, 2, 0}, Mobile},
+		},
+		{
+			"Mozilla/5.0 (iPad; U; CPU OS 4_2_1 like Mac OS X; ja-jp) AppleWebKit/533.17.9 (KHTML, like Gecko) Version/5.0.2 Mobile/8C148 Safari/6533.18.5",
+			UA{"Safari", Version{5, 0, 2}, "iOS", Version{4, 2, 1}, Tablet},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_10_5) AppleWebKit/600.8.9 (KHTML, like Gecko) Version/8.0.8 Safari/600.8.9",
+			UA{"Safari", Version{8, 0, 8}, "Mac OS X", Version{10, 10, 5}, Desktop},
+		},
+		{
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:49.0) Gecko/20100101 Firefox/49.0",
+			UA{"Firefox", Version{49, 0, 0}, "Linux", Version{}, Desktop},
+		},
+		{
+			"Mozilla/5.0 (X11; Linux i686; rv:12.0) Gecko/20120502 Firefox/12.0 SeaMonkey/2.9.1",
+			UA{"SeaMonkey", Version{2, 9, 1}, "Linux", Version{}, Desktop},
+		},
+		{
+			"Opera/9.80 (X11; FreeBSD 8.1-RELEASE i386; Edition Next) Presto/2.12.388 Version/12.10",
+			UA{"Opera", Version{12, 10, 0}, "FreeBSD", Version{}, Desktop},
+		},
+		{
+			"SonyEricssonW950i/R100 Mozilla/4.0 (compatible; MSIE 6.0; Symbian OS; 323) Opera 8.60 [en-US]",
+			UA{"Opera", Version{8, 60, 0}, "Symbian", Version{}, Mobile},
+		},
+		{
+			"Opera/9.80 (J2ME/MIDP; Opera Mini/5.0.16823/1428; U; en) Presto/2.2.0",
+			UA{"Opera Mini", Version{5, 0, 16823}, "Other", Version{}, Mobile},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/33.0.1750.154 Safari/537.36 OPR/20.0.1387.91",
+			UA{"Opera", Version{20, 0, 1387}, "Windows", Version{6, 1, 0}, Desktop},
+		},
+		{
+			"Googlebot/2.1 ( http://www.googlebot.com/bot.html)",
+			UA{"Googlebot", Version{2, 1, 0}, "Other", Version{}, Bot},
+		},
+		{
+			"BlackBerry9700/5.0.0.351 Profile/MIDP-2.1 Configuration/CLDC-1.1 VendorID/123",
+			UA{"BlackBerry9700", Version{5, 0, 0}, "BlackBerry", Version{}, Mobile},
+		},
+		{
+			"Wget/1.12 (freebsd8.1)",
+			UA{"Wget", Version{1, 12, 0}, "Other", Version{}, Desktop},
+		},
+		{
+			"EmailWolf 1.00",
+			UA{"EmailWolf", Version{1, 0, 0}, "Other", Version{}, Desktop},
+		},
+		{
+			"Facebot",
+			UA{"Facebot", Version{}, "Other", Version{}, Bot},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.exp.Family, func(t *testing.T) {
+			if got := Parse(test.ua); got != test.exp {
+				t.Errorf("%s\nexp %+v\ngot %+v", test.ua, test.exp, got)
+			}
+		})
+	}
+}
+
+func TestParseAllocs(t *testing.T) {
+	s := "Mozilla/5.0 (compatible; MSIE 9.0; Windows NT 6.1; WOW64; Trident/5.0; SLCC2; Media Center PC 6.0)"
+
+	allocs := testing.AllocsPerRun(100, func() {
+		Parse(s)
+	})
+
+	if allocs != 0 {
+		t.Fatalf("exp no allocations, got %v", allocs)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		version Version
+		exp     int
+	}{
+		{"9", Version{8, 0, 0}, -1},
+		{"9", Version{9, 5, 1}, 0},
+		{"9", Version{10, 0, 0}, 1},
+		{"9.0", Version{9, 5, 0}, 1},
+		{"10_6", Version{10, 6, 3}, 0},
+		{"1.9.1", Version{1, 9, 0}, -1},
+	}
+
+	for _, test := range tests {
+		p, ok := ParsePattern(test.pattern)
+		if !ok {
+			t.Fatalf("%s: not a version", test.pattern)
+		}
+		if got := p.Compare(test.version); got != test.exp {
+			t.Errorf("%s vs %v: exp %d, got %d", test.pattern, test.version, test.exp, got)
+		}
+	}
+
+	if _, ok := ParsePattern("x"); ok {
+		t.Error("x: exp not a version")
+	}
+}
@@ -0,0 +1,86 @@
+package ua
+
+import "strconv"
+
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// ParseVersion reads up to three numbers separated by . or _ from the start
+// of s and ignores the rest, so "10_6_3" is 10.6.3 and "1.9a3pre" is 1.9
+func ParseVersion(s string) Version {
+	v, _ := parseVersion(s)
+	return v
+}
+
+// parseVersion also returns the number of components that were present
+func parseVersion(s string) (Version, int) {
+	parts := [3]int{}
+	n := 0
+
+	for n < len(parts) {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			parts[n] = parts[n]*10 + int(s[i]-'0')
+			i++
+		}
+		if i == 0 {
+			break
+		}
+		n++
+
+		if i == len(s) || s[i] != '.' && s[i] != '_' {
+			break
+		}
+		s = s[i+1:]
+	}
+
+	return Version{parts[0], parts[1], parts[2]}, n
+}
+
+func (v Version) Compare(o Version) int {
+	switch {
+	case v.Major != o.Major:
+		return cmp(v.Major, o.Major)
+	case v.Minor != o.Minor:
+		return cmp(v.Minor, o.Minor)
+	}
+	return cmp(v.Patch, o.Patch)
+}
+
+func cmp(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Pattern is a version with some trailing components left out, "9" matches
+// every 9.x.y
+type Pattern struct {
+	v Version
+	n int
+}
+
+func ParsePattern(s string) (Pattern, bool) {
+	v, n := parseVersion(s)
+	return Pattern{v, n}, n > 0
+}
+
+// Compare compares only the components present in the pattern
+func (p Pattern) Compare(v Version) int {
+	switch p.n {
+	case 1:
+		v = Version{Major: v.Major}
+	case 2:
+		v = Version{Major: v.Major, Minor: v.Minor}
+	}
+	return v.Compare(p.v)
+}
+
+func (v Version) String() string {
+	return strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Patch)
+}
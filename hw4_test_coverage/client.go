@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -47,6 +48,66 @@ const (
 	ErrorBadOrderField = `OrderField invalid`
 )
 
+var (
+	// ErrUnauthorized means that the server did not accept AccessToken
+	ErrUnauthorized = errors.New("Bad AccessToken")
+	// ErrServer is an internal error of the server
+	ErrServer = errors.New("SearchServer fatal error")
+	// ErrClientConfig means that HTTPClient is set together with Transport
+	// or Timeout
+	ErrClientConfig = errors.New("HTTPClient can't be used with Transport or Timeout")
+)
+
+// BadRequestError is a request refused by the client or by the server. Field
+// is the invalid field of SearchRequest, empty when the server did not say
+type BadRequestError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *BadRequestError) Error() string {
+	if e.Field == "" {
+		return "unknown bad request error: " + e.Reason
+	}
+	return fmt.Sprintf("%s %q invalid: %s", e.Field, e.Value, e.Reason)
+}
+
+// TimeoutError is a request that took longer than the timeout of the client
+// or the deadline of the context
+type TimeoutError struct {
+	Query string
+	Err   error
+}
+
+func (e *TimeoutError) Error() string {
+	return "timeout for " + e.Query
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// DecodeError is a response that is not the expected json, What is either
+// "error" or "result"
+type DecodeError struct {
+	What string
+	Body []byte
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cant unpack %s json: %s", e.What, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
 type SearchRequest struct {
 	Limit      int
 	Offset     int    // Можно учесть после сортировки
@@ -61,21 +122,55 @@ type SearchClient struct {
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+
+	// HTTPClient does the requests. If it is nil a client with Transport and
+	// Timeout does, http.DefaultTransport and a second if they are not set.
+	// Setting HTTPClient and either of them is ErrClientConfig
+	HTTPClient *http.Client
+	Transport  http.RoundTripper
+	Timeout    time.Duration
+
+	// Header is sent with every request, AccessToken replaces the one in it
+	Header http.Header
+}
+
+func (srv *SearchClient) httpClient() *http.Client {
+	switch {
+	case srv.HTTPClient != nil:
+		return srv.HTTPClient
+	case srv.Transport == nil && srv.Timeout == 0:
+		return client
+	}
+
+	c := &http.Client{Transport: srv.Transport, Timeout: srv.Timeout}
+	if c.Timeout == 0 {
+		c.Timeout = client.Timeout
+	}
+	return c
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+// FindUsersContext is FindUsers with ctx for the request
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+
+	if srv.HTTPClient != nil && (srv.Transport != nil || srv.Timeout != 0) {
+		return nil, ErrClientConfig
+	}
 
 	searcherParams := url.Values{}
 
 	if req.Limit < 0 {
-		return nil, fmt.Errorf("limit must be > 0")
+		return nil, &BadRequestError{Field: "Limit", Value: strconv.Itoa(req.Limit), Reason: "must be >= 0"}
 	}
 	if req.Limit > 25 {
 		req.Limit = 25
 	}
 	if req.Offset < 0 {
-		return nil, fmt.Errorf("offset must be > 0")
+		return nil, &BadRequestError{Field: "Offset", Value: strconv.Itoa(req.Offset), Reason: "must be >= 0"}
 	}
 
 	//нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
@@ -87,40 +182,52 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
 
-	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
-	
-	resp, err := client.Do(searcherReq)
+	searcherReq, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"?"+searcherParams.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("cant make request: %w", err)
+	}
+	for k, v := range srv.Header {
+		searcherReq.Header[k] = append([]string{}, v...)
+	}
+	searcherReq.Header.Set("AccessToken", srv.AccessToken)
+
+	resp, err := srv.httpClient().Do(searcherReq)
 	if err != nil {
 		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
+			return nil, &TimeoutError{Query: searcherParams.Encode(), Err: err}
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("request canceled: %w", ctx.Err())
 		}
-		return nil, fmt.Errorf("unknown error %s", err)
+		return nil, fmt.Errorf("unknown error %w", err)
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cant read response: %w", err)
+	}
 
 	switch resp.StatusCode {
 	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
+		return nil, ErrUnauthorized
 	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
+		return nil, ErrServer
 	case http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
 		if err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
+			return nil, &DecodeError{What: "error", Body: body, Err: err}
 		}
-		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderFeld %s invalid", req.OrderField)
+		if errResp.Error == ErrorBadOrderField {
+			return nil, &BadRequestError{Field: "OrderField", Value: req.OrderField, Reason: errResp.Error}
 		}
-		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
+		return nil, &BadRequestError{Reason: errResp.Error}
 	}
 
 	data := []User{}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return nil, fmt.Errorf("cant unpack result json: %s", err)
+		return nil, &DecodeError{What: "result", Body: body, Err: err}
 	}
 
 	result := SearchResponse{}
@@ -1,3 +1,573 @@
 package main
 
-// код писать тут
\ No newline at end of file
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+var datasetPath = "dataset.xml"
+
+// SearchServer is the external system FindUsers talks to, it searches the
+// users of dataset.xml
+type SearchServer struct {
+	users []User
+	token string
+}
+
+type datasetRow struct {
+	Id        int    `xml:"id"`
+	Age       int    `xml:"age"`
+	FirstName string `xml:"first_name"`
+	LastName  string `xml:"last_name"`
+	Gender    string `xml:"gender"`
+	About     string `xml:"about"`
+}
+
+func NewSearchServer(path, token string) (*SearchServer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dataset := struct {
+		Rows []datasetRow `xml:"row"`
+	}{}
+	if err := xml.Unmarshal(data, &dataset); err != nil {
+		return nil, err
+	}
+
+	s := &SearchServer{token: token}
+	for _, r := range dataset.Rows {
+		s.users = append(s.users, User{
+			Id:     r.Id,
+			Name:   r.FirstName + " " + r.LastName,
+			Age:    r.Age,
+			About:  r.About,
+			Gender: r.Gender,
+		})
+	}
+
+	return s, nil
+}
+
+var orderFields = map[string]func(a, b *User) bool{
+	"Id":   func(a, b *User) bool { return a.Id < b.Id },
+	"Age":  func(a, b *User) bool { return a.Age < b.Age },
+	"Name": func(a, b *User) bool { return a.Name < b.Name },
+}
+
+// ServeHTTP finds the users with query in Name or About, sorts them by
+// order_field, Name if it is empty, and returns the page of limit users from
+// offset, all of them if limit is 0. order_by is -1 for descending, 1 for
+// ascending and 0 for the dataset order as SearchRequest says, the names of
+// the OrderBy constants are the other way round
+func (s *SearchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("AccessToken") != s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit < 0 {
+		writeError(w, "Limit invalid")
+		return
+	}
+	offset, err := strconv.Atoi(q.Get("offset"))
+	if err != nil || offset < 0 {
+		writeError(w, "Offset invalid")
+		return
+	}
+
+	field := q.Get("order_field")
+	if field == "" {
+		field = "Name"
+	}
+	less, ok := orderFields[field]
+	if !ok {
+		writeError(w, ErrorBadOrderField)
+		return
+	}
+
+	orderBy, err := strconv.Atoi(q.Get("order_by"))
+	if err != nil || orderBy < OrderByAsc || orderBy > OrderByDesc {
+		writeError(w, "OrderBy invalid")
+		return
+	}
+
+	query := q.Get("query")
+	users := []User{}
+	for _, u := range s.users {
+		if strings.Contains(u.Name, query) || strings.Contains(u.About, query) {
+			users = append(users, u)
+		}
+	}
+
+	switch orderBy {
+	case -1:
+		sort.SliceStable(users, func(i, j int) bool { return less(&users[j], &users[i]) })
+	case 1:
+		sort.SliceStable(users, func(i, j int) bool { return less(&users[i], &users[j]) })
+	}
+
+	users = users[min(offset, len(users)):]
+	if limit > 0 && limit < len(users) {
+		users = users[:limit]
+	}
+
+	js, _ := json.Marshal(users)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+func writeError(w http.ResponseWriter, err string) {
+	js, _ := json.Marshal(SearchErrorResponse{Error: err})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(js)
+}
+
+func newTestServer(t *testing.T) (*SearchServer, *httptest.Server) {
+	s, err := NewSearchServer(datasetPath, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func ids(users []User) []int {
+	rv := []int{}
+	for _, u := range users {
+		rv = append(rv, u.Id)
+	}
+	return rv
+}
+
+func equalIds(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSearchServerDataset(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	if len(s.users) != 35 {
+		t.Fatalf("got %d users, expected 35", len(s.users))
+	}
+	u := s.users[0]
+	if u.Id != 0 || u.Name != "Boyd Wolf" || u.Age != 22 || u.Gender != "male" ||
+		!strings.HasPrefix(u.About, "Nulla cillum enim") {
+		t.Errorf("bad first user: %+v", u)
+	}
+
+	if _, err := NewSearchServer("missing.xml", testToken); err == nil {
+		t.Error("expected error for a missing dataset")
+	}
+	bad := t.TempDir() + "/bad.xml"
+	os.WriteFile(bad, []byte("<root><row><id>x</id></row></root>"), 0o644)
+	if _, err := NewSearchServer(bad, testToken); err == nil {
+		t.Error("expected error for a broken dataset")
+	}
+}
+
+func TestFindUsers(t *testing.T) {
+	s, ts := newTestServer(t)
+	sc := &SearchClient{AccessToken: testToken, URL: ts.URL}
+
+	byName := append([]User{}, s.users...)
+	sort.SliceStable(byName, func(i, j int) bool { return byName[i].Name < byName[j].Name })
+
+	cases := []struct {
+		name     string
+		req      SearchRequest
+		ids      []int
+		nextPage bool
+	}{
+		{
+			name: "as is",
+			req:  SearchRequest{Limit: 3},
+			ids:  []int{0, 1, 2},
+			// there are more than 3 users
+			nextPage: true,
+		},
+		{
+			name:     "offset",
+			req:      SearchRequest{Limit: 2, Offset: 33},
+			ids:      []int{33, 34},
+			nextPage: false,
+		},
+		{
+			name: "past the end",
+			req:  SearchRequest{Limit: 5, Offset: 100},
+			ids:  []int{},
+		},
+		{
+			name:     "limit is capped",
+			req:      SearchRequest{Limit: 100},
+			ids:      ids(s.users[:25]),
+			nextPage: true,
+		},
+		{
+			name: "no limit",
+			req:  SearchRequest{Limit: 0},
+			ids:  []int{},
+			// the server is asked for a single user to see the next page
+			nextPage: true,
+		},
+		{
+			name: "query in name",
+			req:  SearchRequest{Limit: 10, Query: "Boyd Wolf"},
+			ids:  []int{0},
+		},
+		{
+			name: "query in about",
+			req:  SearchRequest{Limit: 10, Query: "Nulla cillum enim"},
+			ids:  []int{0},
+		},
+		{
+			name: "nothing found",
+			req:  SearchRequest{Limit: 10, Query: "no such user"},
+			ids:  []int{},
+		},
+		{
+			name:     "by name, empty field",
+			req:      SearchRequest{Limit: 25, OrderBy: 1},
+			ids:      ids(byName[:25]),
+			nextPage: true,
+		},
+		{
+			name:     "by name desc",
+			req:      SearchRequest{Limit: 2, OrderField: "Name", OrderBy: -1},
+			ids:      []int{byName[len(byName)-1].Id, byName[len(byName)-2].Id},
+			nextPage: true,
+		},
+		{
+			name:     "by id desc",
+			req:      SearchRequest{Limit: 3, Offset: 1, OrderField: "Id", OrderBy: -1},
+			ids:      []int{33, 32, 31},
+			nextPage: true,
+		},
+		{
+			name:     "by id asc",
+			req:      SearchRequest{Limit: 3, Offset: 1, OrderField: "Id", OrderBy: 1},
+			ids:      []int{1, 2, 3},
+			nextPage: true,
+		},
+		{
+			name: "by age",
+			req:  SearchRequest{Limit: 25, Query: "Boyd", OrderField: "Age", OrderBy: -1},
+			ids:  []int{0},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := sc.FindUsers(c.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(resp.Users); !equalIds(got, c.ids) {
+				t.Errorf("got users %v, expected %v", got, c.ids)
+			}
+			if resp.NextPage != c.nextPage {
+				t.Errorf("got next page %v, expected %v", resp.NextPage, c.nextPage)
+			}
+		})
+	}
+}
+
+func TestFindUsersByAge(t *testing.T) {
+	_, ts := newTestServer(t)
+	sc := &SearchClient{AccessToken: testToken, URL: ts.URL}
+
+	// -1 is descending, 1 ascending
+	for _, orderBy := range []int{-1, 1} {
+		resp, err := sc.FindUsers(SearchRequest{Limit: 25, OrderField: "Age", OrderBy: orderBy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i < len(resp.Users); i++ {
+			prev, cur := resp.Users[i-1].Age, resp.Users[i].Age
+			if orderBy == -1 && prev < cur || orderBy == 1 && prev > cur {
+				t.Errorf("order by %d: age %d before %d", orderBy, prev, cur)
+			}
+		}
+	}
+}
+
+func isBadRequest(field string) func(err error) bool {
+	return func(err error) bool {
+		e := &BadRequestError{}
+		return errors.As(err, &e) && e.Field == field
+	}
+}
+
+func isDecodeError(what string) func(err error) bool {
+	return func(err error) bool {
+		e := &DecodeError{}
+		return errors.As(err, &e) && e.What == what
+	}
+}
+
+func isTimeout(err error) bool {
+	e := &TimeoutError{}
+	return errors.As(err, &e)
+}
+
+func is(target error) func(err error) bool {
+	return func(err error) bool { return errors.Is(err, target) }
+}
+
+func isURLError(err error) bool {
+	e := &url.Error{}
+	return errors.As(err, &e)
+}
+
+func TestFindUsersErrors(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	cases := []struct {
+		name   string
+		client *SearchClient
+		req    SearchRequest
+		check  func(err error) bool
+	}{
+		{"negative limit", &SearchClient{AccessToken: testToken, URL: ts.URL}, SearchRequest{Limit: -1}, isBadRequest("Limit")},
+		{"negative offset", &SearchClient{AccessToken: testToken, URL: ts.URL}, SearchRequest{Offset: -1}, isBadRequest("Offset")},
+		{"bad token", &SearchClient{AccessToken: "wrong", URL: ts.URL}, SearchRequest{Limit: 1}, is(ErrUnauthorized)},
+		{"bad order field", &SearchClient{AccessToken: testToken, URL: ts.URL}, SearchRequest{Limit: 1, OrderField: "About"}, isBadRequest("OrderField")},
+		{"bad order by", &SearchClient{AccessToken: testToken, URL: ts.URL}, SearchRequest{Limit: 1, OrderBy: 2}, isBadRequest("")},
+		{"bad url", &SearchClient{AccessToken: testToken, URL: "http://\x7f"}, SearchRequest{Limit: 1}, isURLError},
+		{"http client and timeout", &SearchClient{AccessToken: testToken, URL: ts.URL, HTTPClient: &http.Client{}, Timeout: time.Second}, SearchRequest{Limit: 1}, is(ErrClientConfig)},
+		{"http client and transport", &SearchClient{AccessToken: testToken, URL: ts.URL, HTTPClient: &http.Client{}, Transport: &roundTripper{}}, SearchRequest{Limit: 1}, is(ErrClientConfig)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := c.client.FindUsers(c.req)
+			if !c.check(err) {
+				t.Errorf("unexpected error %#v, response %+v", err, resp)
+			}
+		})
+	}
+
+	_, err := (&SearchClient{AccessToken: testToken, URL: ts.URL}).FindUsers(SearchRequest{OrderField: "About"})
+	if err == nil || err.Error() != `OrderField "About" invalid: `+ErrorBadOrderField {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestSearchServerErrors(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	for _, c := range []struct {
+		query  string
+		token  string
+		status int
+		err    string
+	}{
+		{"limit=1&offset=0&order_by=0", testToken, http.StatusOK, ""},
+		{"limit=1&offset=0&order_by=0", "", http.StatusUnauthorized, ""},
+		{"limit=x&offset=0&order_by=0", testToken, http.StatusBadRequest, "Limit invalid"},
+		{"limit=1&offset=-1&order_by=0", testToken, http.StatusBadRequest, "Offset invalid"},
+		{"limit=1&offset=0&order_by=0&order_field=Gender", testToken, http.StatusBadRequest, ErrorBadOrderField},
+		{"limit=1&offset=0&order_by=-2", testToken, http.StatusBadRequest, "OrderBy invalid"},
+	} {
+		req, _ := http.NewRequest("GET", ts.URL+"?"+c.query, nil)
+		req.Header.Set("AccessToken", c.token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errResp := SearchErrorResponse{}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status || errResp.Error != c.err {
+			t.Errorf("%s: got %d %q, expected %d %q", c.query, resp.StatusCode, errResp.Error, c.status, c.err)
+		}
+	}
+}
+
+// the cases a SearchServer never gets into
+func TestFindUsersBrokenServer(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		check   func(err error) bool
+	}{
+		{"fatal error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}, is(ErrServer)},
+		{"bad error json", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("{"))
+		}, isDecodeError("error")},
+		{"unknown bad request", func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, "something else")
+		}, isBadRequest("")},
+		{"bad result json", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"Users":[]}`))
+		}, isDecodeError("result")},
+		{"short body", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("[]"))
+		}, is(io.ErrUnexpectedEOF)},
+		{"timeout", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(client.Timeout + 100*time.Millisecond)
+		}, isTimeout},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ts := httptest.NewServer(c.handler)
+			defer ts.Close()
+
+			sc := &SearchClient{AccessToken: testToken, URL: ts.URL}
+			resp, err := sc.FindUsers(SearchRequest{Limit: 1})
+			if !c.check(err) {
+				t.Errorf("unexpected error %#v, response %+v", err, resp)
+			}
+		})
+	}
+
+	// nothing listens there after Close
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	sc := &SearchClient{AccessToken: testToken, URL: ts.URL}
+	if resp, err := sc.FindUsers(SearchRequest{Limit: 1}); err == nil {
+		t.Errorf("expected error, got %+v", resp)
+	}
+}
+
+// roundTripper records the requests and passes them on
+type roundTripper struct {
+	reqs []*http.Request
+}
+
+func (rt *roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.reqs = append(rt.reqs, r)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestFindUsersHTTPConfig(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	rt := &roundTripper{}
+	header := http.Header{"X-Request-Id": {"42"}, "Accesstoken": {"wrong"}}
+	clients := map[string]*SearchClient{
+		"transport":   {AccessToken: testToken, URL: ts.URL, Transport: rt, Header: header},
+		"http client": {AccessToken: testToken, URL: ts.URL, HTTPClient: &http.Client{Transport: rt}, Header: header},
+	}
+
+	for name, sc := range clients {
+		rt.reqs = nil
+		if _, err := sc.FindUsers(SearchRequest{Limit: 1}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if len(rt.reqs) != 1 {
+			t.Fatalf("%s: got %d requests through the transport", name, len(rt.reqs))
+		}
+		h := rt.reqs[0].Header
+		if h.Get("X-Request-Id") != "42" || len(h.Values("AccessToken")) != 1 {
+			t.Errorf("%s: bad header %v", name, h)
+		}
+	}
+
+	if header.Get("AccessToken") != "wrong" {
+		t.Error("the base header was changed")
+	}
+}
+
+func TestFindUsersContext(t *testing.T) {
+	stop := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer ts.Close()
+	defer close(stop)
+
+	sc := &SearchClient{AccessToken: testToken, URL: ts.URL}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := sc.FindUsersContext(ctx, SearchRequest{Limit: 1})
+	if !errors.Is(err, context.Canceled) || isTimeout(err) {
+		t.Errorf("got %v, expected canceled", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = sc.FindUsersContext(ctx, SearchRequest{Limit: 1})
+	if !isTimeout(err) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, expected timeout", err)
+	}
+
+	// a shorter timeout of the client
+	start := time.Now()
+	sc.Timeout = 10 * time.Millisecond
+	_, err = sc.FindUsers(SearchRequest{Limit: 1})
+	if !isTimeout(err) || time.Since(start) > client.Timeout/2 {
+		t.Errorf("got %v after %v, expected timeout", err, time.Since(start))
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	inner := errors.New("inner")
+
+	for _, c := range []struct {
+		err error
+		msg string
+	}{
+		{&BadRequestError{Field: "Limit", Value: "-1", Reason: "must be >= 0"}, `Limit "-1" invalid: must be >= 0`},
+		{&BadRequestError{Reason: "OrderBy invalid"}, "unknown bad request error: OrderBy invalid"},
+		{&TimeoutError{Query: "limit=2", Err: inner}, "timeout for limit=2"},
+		{&DecodeError{What: "result", Err: inner}, "cant unpack result json: inner"},
+	} {
+		if c.err.Error() != c.msg {
+			t.Errorf("got %q, expected %q", c.err, c.msg)
+		}
+	}
+
+	if !errors.Is(&TimeoutError{Err: inner}, inner) || !errors.Is(&DecodeError{Err: inner}, inner) {
+		t.Error("errors do not unwrap")
+	}
+
+	timeout := interface{ Timeout() bool }(&TimeoutError{})
+	if !timeout.Timeout() {
+		t.Error("TimeoutError is not a timeout")
+	}
+}